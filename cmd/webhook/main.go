@@ -4,21 +4,24 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"log"
 	"net/http"
 	"net/url"
 	"os"
 	"os/signal"
+	"regexp"
 	"strconv"
 	"strings"
 	"syscall"
 	"time"
 
+	"github.com/charmbracelet/log"
 	"github.com/labstack/echo/v4"
 
 	"github.com/rackerlabs/external-dns-rackspace-webhook/internal/handlers"
+	"github.com/rackerlabs/external-dns-rackspace-webhook/internal/logging"
 	"github.com/rackerlabs/external-dns-rackspace-webhook/internal/providers"
 	"github.com/rackerlabs/external-dns-rackspace-webhook/internal/routes"
+	"github.com/rackerlabs/external-dns-rackspace-webhook/internal/tracing"
 )
 
 const (
@@ -29,20 +32,30 @@ const (
 	//this can't change unless the chart changes
 	defaultHealthzPort      = 8080
 	defaultIdentityEndpoint = "https://identity.api.rackspacecloud.com/v2.0/"
+	defaultCacheTTL         = 5 * time.Minute
+	// Cloud DNS raises TTLs below 300s and uses 3600s when none is given.
+	defaultTTLMin     = 300
+	defaultTTLDefault = 3600
+	// Default TTL of domains created by AUTO_CREATE_ZONES.
+	defaultZoneTTL = 3600
 )
 
 func main() {
 	config := loadConfig()
-	setupLogging(config.LogLevel)
-	provider, err := providers.NewRackspaceProvider(config)
+	setupLogging(config)
+	shutdownTracing, err := tracing.Setup(context.Background(), config.TracingEnabled)
 	if err != nil {
-		log.Fatalf("Failed to create Rackspace provider: %v", err)
+		log.Fatal("Failed to set up tracing", "error", err)
+	}
+	provider, err := providers.New(config)
+	if err != nil {
+		log.Fatal("Failed to create Rackspace provider", "error", err)
 	}
 	handler := handlers.NewHandler(provider)
 
 	port, err := getStartPort()
 	if err != nil {
-		log.Fatalf("invalid port %s", err)
+		log.Fatal("Invalid port", "error", err)
 	}
 
 	// Webhook API server — localhost only
@@ -58,6 +71,16 @@ func main() {
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
 
+	// Pick up rotated credentials from mounted Secret files without a restart.
+	go provider.WatchCredentials(ctx)
+
+	// Renew the token in the background, ahead of expiry.
+	refresherDone := make(chan struct{})
+	go func() {
+		defer close(refresherDone)
+		provider.RunTokenRefresher(ctx)
+	}()
+
 	errCh := make(chan error, 2)
 
 	// Always scope to localhost:<port>
@@ -70,23 +93,27 @@ func main() {
 	select {
 	case err = <-errCh:
 		if !errors.Is(err, http.ErrServerClosed) {
-			log.Printf("server error: %v", err)
+			log.Error("Server error", "error", err)
 			exitCode = 1
 		}
 	case <-ctx.Done():
-		log.Println("shutdown signal received")
+		log.Info("Shutdown signal received")
 	}
 	stop()
+	<-refresherDone
 
 	// Allow in-flight requests to drain before K8s sends SIGKILL (default 30s grace).
 	shutdownCtx, cancel := context.WithTimeout(context.Background(), 25*time.Second)
 	defer cancel()
 
 	if err := webhook.Shutdown(shutdownCtx); err != nil {
-		log.Printf("webhook shutdown error: %v", err)
+		log.Error("Webhook shutdown error", "error", err)
 	}
 	if err := ops.Shutdown(shutdownCtx); err != nil {
-		log.Printf("ops shutdown error: %v", err)
+		log.Error("Ops shutdown error", "error", err)
+	}
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		log.Error("Tracing shutdown error", "error", err)
 	}
 	os.Exit(exitCode)
 }
@@ -108,14 +135,48 @@ func loadConfig() *providers.RackspaceConfig {
 		Username:         strings.TrimSpace(os.Getenv("RACKSPACE_USERNAME")),
 		APIKey:           strings.TrimSpace(os.Getenv("RACKSPACE_API_KEY")),
 		IdentityEndpoint: strings.TrimSpace(os.Getenv("RACKSPACE_IDENTITY_ENDPOINT")),
+		Region:           strings.TrimSpace(os.Getenv("RACKSPACE_REGION")),
+		DNSEndpoint:      strings.TrimSpace(os.Getenv("RACKSPACE_DNS_ENDPOINT")),
 		DryRun:           false,
 		LogLevel:         "info",
+		LogFormat:        "text",
+		CacheTTL:         defaultCacheTTL,
+	}
+
+	// Mounted Secret files take precedence over the plain variables.
+	if usernameFile := strings.TrimSpace(os.Getenv("RACKSPACE_USERNAME_FILE")); usernameFile != "" {
+		username, err := providers.ReadCredentialFile(usernameFile)
+		if err != nil {
+			log.Fatal("Invalid RACKSPACE_USERNAME_FILE", "error", err)
+		}
+		config.Username, config.UsernameFile = username, usernameFile
+	}
+	if apiKeyFile := strings.TrimSpace(os.Getenv("RACKSPACE_API_KEY_FILE")); apiKeyFile != "" {
+		apiKey, err := providers.ReadCredentialFile(apiKeyFile)
+		if err != nil {
+			log.Fatal("Invalid RACKSPACE_API_KEY_FILE", "error", err)
+		}
+		config.APIKey, config.APIKeyFile = apiKey, apiKeyFile
 	}
 
 	if domainFilter := os.Getenv("DOMAIN_FILTER"); domainFilter != "" {
 		config.DomainFilter = strings.Split(domainFilter, ",")
 	}
 
+	if domainFilterExclude := os.Getenv("DOMAIN_FILTER_EXCLUDE"); domainFilterExclude != "" {
+		config.DomainFilterExclude = strings.Split(domainFilterExclude, ",")
+	}
+
+	if domainIDFilter := os.Getenv("DOMAIN_ID_FILTER"); domainIDFilter != "" {
+		config.DomainIDFilter = strings.Split(domainIDFilter, ",")
+	}
+
+	config.RegexDomainFilter = regexFromEnv("REGEX_DOMAIN_FILTER")
+	config.RegexDomainExclusion = regexFromEnv("REGEX_DOMAIN_EXCLUSION")
+	if (config.RegexDomainFilter != nil || config.RegexDomainExclusion != nil) && (len(config.DomainFilter) > 0 || len(config.DomainFilterExclude) > 0) {
+		log.Warn("REGEX_DOMAIN_FILTER and REGEX_DOMAIN_EXCLUSION take precedence; DOMAIN_FILTER and DOMAIN_FILTER_EXCLUDE are ignored")
+	}
+
 	if dryRun := os.Getenv("DRY_RUN"); dryRun == "true" {
 		config.DryRun = true
 	}
@@ -124,25 +185,203 @@ func loadConfig() *providers.RackspaceConfig {
 		config.LogLevel = logLevel
 	}
 
+	if logFormat := os.Getenv("LOG_FORMAT"); logFormat != "" {
+		config.LogFormat = logFormat
+	}
+
+	if tracingEnabled := os.Getenv("TRACING_ENABLED"); tracingEnabled == "true" {
+		config.TracingEnabled = true
+	}
+
+	if cacheTTL := os.Getenv("CACHE_TTL"); cacheTTL != "" {
+		ttl, err := time.ParseDuration(cacheTTL)
+		if err != nil || ttl < 0 {
+			log.Fatalf("Invalid CACHE_TTL %q: must be a non-negative duration such as 5m", cacheTTL)
+		}
+		config.CacheTTL = ttl
+	}
+
+	if jobTimeout := os.Getenv("JOB_TIMEOUT"); jobTimeout != "" {
+		timeout, err := time.ParseDuration(jobTimeout)
+		if err != nil || timeout <= 0 {
+			log.Fatalf("Invalid JOB_TIMEOUT %q: must be a positive duration such as 2m", jobTimeout)
+		}
+		config.JobTimeout = timeout
+	}
+
+	if maxAttempts := os.Getenv("RETRY_MAX_ATTEMPTS"); maxAttempts != "" {
+		attempts, err := strconv.Atoi(maxAttempts)
+		if err != nil || attempts < 1 {
+			log.Fatalf("Invalid RETRY_MAX_ATTEMPTS %q: must be a positive integer", maxAttempts)
+		}
+		config.RetryMaxAttempts = attempts
+	}
+
+	// Client-side throttling is opt-in: a sync reads every managed zone, and
+	// pacing those reads would slow large accounts down without warning.
+	config.RateLimits = providers.RateLimits{
+		List:   rateLimitFromEnv("RATE_LIMIT_LIST", 0),
+		Create: rateLimitFromEnv("RATE_LIMIT_CREATE", 0),
+		Update: rateLimitFromEnv("RATE_LIMIT_UPDATE", 0),
+		Delete: rateLimitFromEnv("RATE_LIMIT_DELETE", 0),
+	}
+	if fromAccount := os.Getenv("RATE_LIMIT_FROM_ACCOUNT"); fromAccount == "true" {
+		config.RateLimitsFromAccount = true
+	}
+
+	config.TTL = providers.TTLPolicy{
+		Min:     ttlFromEnv("TTL_MIN", defaultTTLMin),
+		Max:     ttlFromEnv("TTL_MAX", 0),
+		Default: ttlFromEnv("TTL_DEFAULT", defaultTTLDefault),
+	}
+	if err := config.TTL.Validate(); err != nil {
+		log.Fatalf("Invalid TTL settings: %v", err)
+	}
+	if overrides := os.Getenv("TTL_DOMAIN_OVERRIDES"); overrides != "" {
+		ttlOverrides, err := providers.ParseTTLOverrides(overrides)
+		if err != nil {
+			log.Fatalf("Invalid TTL_DOMAIN_OVERRIDES: %v", err)
+		}
+		if err := providers.ValidateTTLOverrides(config.TTL, ttlOverrides); err != nil {
+			log.Fatalf("Invalid TTL_DOMAIN_OVERRIDES: %v", err)
+		}
+		config.TTLOverrides = ttlOverrides
+	}
+
+	if accountsFile := strings.TrimSpace(os.Getenv("RACKSPACE_ACCOUNTS_FILE")); accountsFile != "" {
+		accounts, err := providers.LoadAccounts(accountsFile)
+		if err != nil {
+			log.Fatal("Invalid RACKSPACE_ACCOUNTS_FILE", "error", err)
+		}
+		config.Accounts = accounts
+		// The endpoint carries one tenant's number and would send every
+		// account's token there.
+		if config.DNSEndpoint != "" {
+			log.Fatal("RACKSPACE_DNS_ENDPOINT cannot be combined with RACKSPACE_ACCOUNTS_FILE; set dnsEndpoint per account instead")
+		}
+	}
+
+	if preset := strings.TrimSpace(os.Getenv("RACKSPACE_IDENTITY_PRESET")); preset != "" {
+		if config.IdentityEndpoint != "" {
+			log.Fatal("RACKSPACE_IDENTITY_PRESET and RACKSPACE_IDENTITY_ENDPOINT cannot both be set")
+		}
+		identityEndpoint, err := providers.IdentityEndpointForPreset(preset)
+		if err != nil {
+			log.Fatal("Invalid RACKSPACE_IDENTITY_PRESET", "error", err)
+		}
+		config.IdentityEndpoint = identityEndpoint
+	}
 	if config.IdentityEndpoint == "" {
 		config.IdentityEndpoint = defaultIdentityEndpoint
 	}
 
-	// Validate required fields
-	if config.Username == "" {
-		log.Fatal("RACKSPACE_USERNAME is required and cannot be empty")
+	if manageDelegations := os.Getenv("MANAGE_DELEGATIONS"); manageDelegations == "true" {
+		config.ManageDelegations = true
+	}
+
+	if managePTRRecords := os.Getenv("MANAGE_PTR_RECORDS"); managePTRRecords == "true" {
+		config.ManagePTRRecords = true
+	}
+
+	if autoCreate := os.Getenv("AUTO_CREATE_ZONES"); autoCreate == "true" {
+		config.ZoneCreation = providers.ZoneCreation{
+			Enabled: true,
+			Email:   strings.TrimSpace(os.Getenv("AUTO_CREATE_ZONES_EMAIL")),
+			TTL:     uint(ttlFromEnv("AUTO_CREATE_ZONES_TTL", defaultZoneTTL)),
+		}
+		if parents := os.Getenv("AUTO_CREATE_ZONES_PARENTS"); parents != "" {
+			config.ZoneCreation.Parents = strings.Split(parents, ",")
+		}
+		if config.ZoneCreation.Email == "" {
+			log.Fatal("AUTO_CREATE_ZONES_EMAIL is required when AUTO_CREATE_ZONES is enabled")
+		}
+		if len(config.ZoneCreation.Parents) == 0 {
+			log.Fatal("AUTO_CREATE_ZONES_PARENTS is required when AUTO_CREATE_ZONES is enabled")
+		}
+		if config.ZoneCreation.TTL < defaultTTLMin {
+			log.Fatalf("Invalid AUTO_CREATE_ZONES_TTL %d: Cloud DNS requires at least %d seconds", config.ZoneCreation.TTL, defaultTTLMin)
+		}
+		if len(config.DomainIDFilter) > 0 {
+			log.Fatal("AUTO_CREATE_ZONES cannot be combined with DOMAIN_ID_FILTER, since created domains have no ID to list in advance")
+		}
 	}
-	if config.APIKey == "" {
-		log.Fatal("RACKSPACE_API_KEY is required and cannot be empty")
+
+	availability, err := providers.ParseAvailability(os.Getenv("RACKSPACE_DNS_AVAILABILITY"))
+	if err != nil {
+		log.Fatal("Invalid RACKSPACE_DNS_AVAILABILITY", "error", err)
+	}
+	config.Availability = availability
+
+	// Validate required fields. An accounts file carries its own credentials.
+	if len(config.Accounts) == 0 {
+		if config.Username == "" {
+			log.Fatal("RACKSPACE_USERNAME or RACKSPACE_USERNAME_FILE is required and cannot be empty")
+		}
+		if config.APIKey == "" {
+			log.Fatal("RACKSPACE_API_KEY or RACKSPACE_API_KEY_FILE is required and cannot be empty")
+		}
 	}
 	if _, err := url.Parse(config.IdentityEndpoint); err != nil {
 		log.Fatalf("Invalid RACKSPACE_IDENTITY_ENDPOINT URL: %v", err)
 	}
+	if config.DNSEndpoint != "" {
+		if u, err := url.Parse(config.DNSEndpoint); err != nil || u.Scheme == "" || u.Host == "" {
+			log.Fatalf("Invalid RACKSPACE_DNS_ENDPOINT %q: must be an absolute URL", config.DNSEndpoint)
+		}
+	}
 
 	return config
 }
 
-func setupLogging(level string) {
-	log.SetFlags(log.LstdFlags | log.Lshortfile)
-	log.Printf("Log level set to: %s", level)
+// regexFromEnv compiles a domain filter regular expression, returning nil
+// when the variable is unset.
+func regexFromEnv(name string) *regexp.Regexp {
+	value := os.Getenv(name)
+	if value == "" {
+		return nil
+	}
+	re, err := regexp.Compile(value)
+	if err != nil {
+		log.Fatalf("Invalid %s %q: %v", name, value, err)
+	}
+	return re
+}
+
+// rateLimitFromEnv reads a requests-per-minute limit, where 0 means unlimited.
+func rateLimitFromEnv(name string, defaultValue int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return defaultValue
+	}
+	perMinute, err := strconv.Atoi(value)
+	if err != nil || perMinute < 0 {
+		log.Fatalf("Invalid %s %q: must be a non-negative number of requests per minute", name, value)
+	}
+	return perMinute
+}
+
+// ttlFromEnv reads a TTL in seconds, where 0 leaves it unset.
+func ttlFromEnv(name string, defaultValue int64) int64 {
+	value := os.Getenv(name)
+	if value == "" {
+		return defaultValue
+	}
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || seconds < 0 {
+		log.Fatalf("Invalid %s %q: must be a non-negative number of seconds", name, value)
+	}
+	return seconds
+}
+
+// setupLogging applies LOG_LEVEL and LOG_FORMAT to the shared logger and
+// keeps the API key out of every log line.
+func setupLogging(config *providers.RackspaceConfig) {
+	if err := logging.Setup(config.LogLevel, config.LogFormat); err != nil {
+		log.Fatal("Invalid logging configuration", "error", err)
+	}
+	logging.RegisterSecret(config.APIKey)
+	for _, account := range config.Accounts {
+		logging.RegisterSecret(account.APIKey)
+	}
+	log.Info("Logging configured", "level", config.LogLevel, "format", config.LogFormat)
 }
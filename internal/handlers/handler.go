@@ -5,8 +5,8 @@ import (
 	"net/http"
 	"strings"
 
-	"github.com/charmbracelet/log"
 	"github.com/labstack/echo/v4"
+	"github.com/rackerlabs/external-dns-rackspace-webhook/internal/logging"
 	"github.com/rackerlabs/external-dns-rackspace-webhook/internal/providers"
 
 	"sigs.k8s.io/external-dns/endpoint"
@@ -14,27 +14,27 @@ import (
 )
 
 type Handler struct {
-	provider *providers.RackspaceProvider
+	provider providers.Provider
 }
 
-func NewHandler(rackspaceProvider *providers.RackspaceProvider) *Handler {
+func NewHandler(provider providers.Provider) *Handler {
 	return &Handler{
-		provider: rackspaceProvider,
+		provider: provider,
 	}
 }
 
 func (h *Handler) NegotiationHandler(c echo.Context) error {
-	return c.JSON(http.StatusOK, h.provider.DomainFilter)
+	return c.JSON(http.StatusOK, h.provider.GetDomainFilter())
 }
 
 func (h *Handler) HandleGetRecords(c echo.Context) error {
 	endpoints, err := h.provider.Records(c.Request().Context())
 	if err != nil {
-		log.Error("Failed to get records", "error", err)
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		logging.FromContext(c.Request().Context()).Error("Failed to get records", "error", err)
+		return c.JSON(http.StatusInternalServerError, errorBody(c, err))
 	}
 
-	log.Info("GET /records", "count", len(endpoints))
+	logging.FromContext(c.Request().Context()).Info("GET /records", "count", len(endpoints))
 	return c.JSON(http.StatusOK, endpoints)
 }
 
@@ -42,15 +42,20 @@ func (h *Handler) HandleGetRecords(c echo.Context) error {
 // For SRV records, RFC 2782 requires the target host to be an absolute
 // FQDN (trailing dot).  Sources that omit the dot would be rejected by
 // external-dns's ValidateSRVRecord, so we append it here as a safety net.
+// MX hosts get the same treatment so they compare equal to the
+// "preference host." form that Records reassembles from the API.
+// TTLs are defaulted and clamped by the provider's TTL policy, so desired
+// TTLs match what Cloud DNS stores and do not show up as endless updates.
 func (h *Handler) HandleAdjustEndpoints(c echo.Context) error {
 	defer c.Request().Body.Close()
 	var endpoints []*endpoint.Endpoint
 	if err := json.NewDecoder(c.Request().Body).Decode(&endpoints); err != nil {
-		log.Error("Failed to decode input", "error", err)
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		logging.FromContext(c.Request().Context()).Error("Failed to decode input", "error", err)
+		return c.JSON(http.StatusBadRequest, errorBody(c, err))
 	}
 
 	for _, ep := range endpoints {
+		h.provider.AdjustTTL(ep)
 		if ep.RecordType == "SRV" {
 			for i, target := range ep.Targets {
 				parts := strings.SplitN(target, " ", 4)
@@ -59,9 +64,17 @@ func (h *Handler) HandleAdjustEndpoints(c echo.Context) error {
 				}
 			}
 		}
+		if ep.RecordType == "MX" {
+			for i, target := range ep.Targets {
+				parts := strings.Fields(target)
+				if len(parts) == 2 && !strings.HasSuffix(parts[1], ".") {
+					ep.Targets[i] = parts[0] + " " + parts[1] + "."
+				}
+			}
+		}
 	}
 
-	log.Info("POST /adjustendpoints", "count", len(endpoints))
+	logging.FromContext(c.Request().Context()).Info("POST /adjustendpoints", "count", len(endpoints))
 	return c.JSON(http.StatusOK, endpoints)
 }
 
@@ -69,14 +82,24 @@ func (h *Handler) HandlePostRecords(c echo.Context) error {
 	defer c.Request().Body.Close()
 	var changes plan.Changes
 	if err := json.NewDecoder(c.Request().Body).Decode(&changes); err != nil {
-		log.Error("Failed to decode input", "error", err)
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		logging.FromContext(c.Request().Context()).Error("Failed to decode input", "error", err)
+		return c.JSON(http.StatusBadRequest, errorBody(c, err))
 	}
-	log.Info("POST /records", "create", len(changes.Create), "updateNew", len(changes.UpdateNew), "delete", len(changes.Delete))
+	logging.FromContext(c.Request().Context()).Info("POST /records", "create", len(changes.Create), "updateNew", len(changes.UpdateNew), "delete", len(changes.Delete))
 	if err := h.provider.ApplyChanges(c.Request().Context(), &changes); err != nil {
-		log.Error("Failed to apply changes", "error", err)
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		logging.FromContext(c.Request().Context()).Error("Failed to apply changes", "error", err)
+		return c.JSON(http.StatusInternalServerError, errorBody(c, err))
 	}
 
 	return c.NoContent(http.StatusNoContent)
 }
+
+// errorBody builds the JSON error response. It carries the request ID so a
+// failure logged by external-dns can be matched with the webhook's own logs.
+func errorBody(c echo.Context, err error) map[string]string {
+	body := map[string]string{"error": logging.Redact(err.Error())}
+	if id := logging.RequestIDFrom(c.Request().Context()); id != "" {
+		body["requestID"] = id
+	}
+	return body
+}
@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/rackerlabs/external-dns-rackspace-webhook/internal/middleware"
+	"github.com/rackerlabs/external-dns-rackspace-webhook/internal/tracing"
+)
+
+func TestHandlePostRecords_ErrorCarriesRequestID(t *testing.T) {
+	tests := []struct {
+		name      string
+		requestID string
+	}{
+		{name: "caller supplied ID", requestID: "external-dns-42"},
+		{name: "generated ID"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := echo.New()
+			e.Use(middleware.RequestIDMiddleware())
+			h := &Handler{}
+			e.POST("/records", h.HandlePostRecords)
+
+			req := httptest.NewRequest(http.MethodPost, "/records", strings.NewReader("{not json"))
+			if tt.requestID != "" {
+				req.Header.Set(echo.HeaderXRequestID, tt.requestID)
+			}
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusBadRequest {
+				t.Fatalf("Expected status code %d, got %d", http.StatusBadRequest, rec.Code)
+			}
+			gotHeader := rec.Header().Get(echo.HeaderXRequestID)
+			if gotHeader == "" || (tt.requestID != "" && gotHeader != tt.requestID) {
+				t.Errorf("Expected X-Request-Id %q, got %q", tt.requestID, gotHeader)
+			}
+
+			var body map[string]string
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatalf("Failed to parse response body: %v", err)
+			}
+			if body["requestID"] != gotHeader {
+				t.Errorf("Expected requestID %q in error body, got %q", gotHeader, body["requestID"])
+			}
+			if body["error"] == "" {
+				t.Error("Expected an error message in the response body")
+			}
+		})
+	}
+}
+
+func TestTracingMiddleware_ContinuesIncomingTrace(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	defer otel.SetTracerProvider(previous)
+	if _, err := tracing.Setup(context.Background(), false); err != nil {
+		t.Fatalf("tracing.Setup() error: %v", err)
+	}
+
+	e := echo.New()
+	e.Use(middleware.TracingMiddleware)
+	h := &Handler{}
+	e.POST("/records", h.HandlePostRecords)
+
+	req := httptest.NewRequest(http.MethodPost, "/records", strings.NewReader("{not json"))
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	spans := exporter.GetSpans()
+	if len(spans) != 1 {
+		t.Fatalf("Expected 1 span, got %d", len(spans))
+	}
+	span := spans[0]
+	if span.Name != "POST /records" {
+		t.Errorf("Expected span name %q, got %q", "POST /records", span.Name)
+	}
+	if got := span.SpanContext.TraceID().String(); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("Expected the incoming trace ID, got %s", got)
+	}
+	if got := span.Parent.SpanID().String(); got != "00f067aa0ba902b7" {
+		t.Errorf("Expected the incoming span as parent, got %s", got)
+	}
+	if span.Status.Code == codes.Error {
+		t.Error("A 400 response should not mark the server span as failed")
+	}
+}
@@ -10,3 +10,22 @@ func (h *Handler) HealthHandler(c echo.Context) error {
 	c.Response().Header().Set(echo.HeaderContentType, "application/external.dns.webhook+json;version=1")
 	return c.JSON(http.StatusOK, map[string]string{"status": "ok"})
 }
+
+// ReadyHandler reports whether the webhook can currently reach Cloud DNS.
+// It returns 503 with the failing checks when authentication, the token
+// lifetime or the last Cloud DNS list call indicate a problem.
+func (h *Handler) ReadyHandler(c echo.Context) error {
+	c.Response().Header().Set(echo.HeaderContentType, "application/external.dns.webhook+json;version=1")
+	readiness := h.provider.Readiness()
+	status, code := "ok", http.StatusOK
+	if !readiness.Ready {
+		status, code = "unavailable", http.StatusServiceUnavailable
+	}
+	body := map[string]interface{}{"status": status, "checks": readiness.Checks}
+	if readiness.Accounts != nil {
+		body["accounts"] = readiness.Accounts
+	} else {
+		body["tokenRefresh"] = readiness.Token
+	}
+	return c.JSON(code, body)
+}
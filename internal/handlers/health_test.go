@@ -8,6 +8,7 @@ import (
 	"testing"
 
 	"github.com/labstack/echo/v4"
+	"github.com/rackerlabs/external-dns-rackspace-webhook/internal/providers"
 )
 
 func TestHealthHandler(t *testing.T) {
@@ -96,3 +97,40 @@ func TestHealthHandler_ResponseFormat(t *testing.T) {
 		t.Errorf("Response should contain exactly 1 field, got %d fields: %v", len(response), response)
 	}
 }
+
+func TestReadyHandler_NotReady(t *testing.T) {
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/readyz", nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	// A provider that has never authenticated has no token
+	h := &Handler{provider: &providers.RackspaceProvider{}}
+
+	if err := h.ReadyHandler(c); err != nil {
+		t.Fatalf("ReadyHandler() returned unexpected error: %v", err)
+	}
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status code %d, got %d", http.StatusServiceUnavailable, rec.Code)
+	}
+
+	var response struct {
+		Status string                              `json:"status"`
+		Checks map[string]providers.ReadinessCheck `json:"checks"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse JSON response: %v", err)
+	}
+	if response.Status != "unavailable" {
+		t.Errorf("Expected status %q, got %q", "unavailable", response.Status)
+	}
+	if response.Checks["token"].OK {
+		t.Errorf("Expected token check to fail, got %+v", response.Checks["token"])
+	}
+	for _, name := range []string{"authentication", "cloudDNS"} {
+		if !response.Checks[name].OK {
+			t.Errorf("Expected %s check to pass, got %+v", name, response.Checks[name])
+		}
+	}
+}
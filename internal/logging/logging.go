@@ -0,0 +1,129 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	stdlog "log"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/charmbracelet/log"
+)
+
+const redacted = "[REDACTED]"
+
+// secretFields matches credential fields as they appear in request bodies,
+// headers and URLs echoed back in API errors.
+var secretFields = regexp.MustCompile(`(?i)("?(?:apikey|api_key|api-key|password|x-auth-token|x-subject-token)"?\s*[:=]\s*"?)([^"\s,;&}]+)`)
+
+var (
+	secretsMu sync.RWMutex
+	secrets   []string
+)
+
+// Setup configures the shared charmbracelet logger used by every package.
+// level is one of debug, info, warn or error; format is one of text, json
+// or logfmt. Output, including the standard library logger, goes through a
+// writer that redacts registered credentials.
+func Setup(level, format string) error {
+	parsedLevel, err := log.ParseLevel(strings.ToLower(strings.TrimSpace(level)))
+	if err != nil {
+		return fmt.Errorf("invalid log level %q: %w", level, err)
+	}
+	formatter, err := parseFormat(format)
+	if err != nil {
+		return err
+	}
+
+	w := NewRedactingWriter(os.Stderr)
+	log.SetOutput(w)
+	log.SetLevel(parsedLevel)
+	log.SetFormatter(formatter)
+	log.SetReportTimestamp(true)
+
+	stdlog.SetFlags(0)
+	stdlog.SetOutput(log.StandardLog().Writer())
+	return nil
+}
+
+func parseFormat(format string) (log.Formatter, error) {
+	switch strings.ToLower(strings.TrimSpace(format)) {
+	case "", "text":
+		return log.TextFormatter, nil
+	case "json":
+		return log.JSONFormatter, nil
+	case "logfmt":
+		return log.LogfmtFormatter, nil
+	}
+	return 0, fmt.Errorf("invalid log format %q: must be text, json or logfmt", format)
+}
+
+// RegisterSecret makes every later log line replace value with a placeholder.
+// Empty values are ignored.
+func RegisterSecret(value string) {
+	if value == "" {
+		return
+	}
+	secretsMu.Lock()
+	defer secretsMu.Unlock()
+	for _, s := range secrets {
+		if s == value {
+			return
+		}
+	}
+	secrets = append(secrets, value)
+}
+
+// Redact removes registered secrets and credential fields from s.
+func Redact(s string) string {
+	secretsMu.RLock()
+	for _, secret := range secrets {
+		s = strings.ReplaceAll(s, secret, redacted)
+	}
+	secretsMu.RUnlock()
+	return secretFields.ReplaceAllString(s, "${1}"+redacted)
+}
+
+type redactingWriter struct {
+	w io.Writer
+}
+
+// NewRedactingWriter returns a writer that applies Redact to everything
+// written to w. The logger writes each entry in a single call, so values
+// are never split across writes.
+func NewRedactingWriter(w io.Writer) io.Writer {
+	return &redactingWriter{w: w}
+}
+
+func (r *redactingWriter) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(r.w, Redact(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+type requestIDKey struct{}
+
+// WithRequestID returns a context carrying the correlation ID of the webhook
+// request being served.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFrom returns the correlation ID stored in ctx, or "".
+func RequestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// FromContext returns the shared logger, tagged with the request ID when ctx
+// carries one.
+func FromContext(ctx context.Context) *log.Logger {
+	if id := RequestIDFrom(ctx); id != "" {
+		return log.With("requestID", id)
+	}
+	return log.Default()
+}
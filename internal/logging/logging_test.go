@@ -0,0 +1,62 @@
+package logging
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/charmbracelet/log"
+)
+
+func TestRedact(t *testing.T) {
+	RegisterSecret("s3cr3t-api-key")
+
+	tests := []struct {
+		name    string
+		input   string
+		leaked  string
+		present string
+	}{
+		{name: "registered value", input: "failed to authenticate: bad key s3cr3t-api-key", leaked: "s3cr3t-api-key", present: redacted},
+		{name: "json api key field", input: `{"apiKeyCredentials":{"username":"u","apiKey":"abc123"}}`, leaked: "abc123", present: `"apiKey":"` + redacted},
+		{name: "auth token header", input: "X-Auth-Token: tok-456 rejected", leaked: "tok-456", present: "X-Auth-Token: " + redacted},
+		{name: "query parameter", input: "GET /auth?password=hunter2&user=u", leaked: "hunter2", present: "password=" + redacted + "&user=u"},
+		{name: "nothing to redact", input: "Fetched records count=3", present: "Fetched records count=3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Redact(tt.input)
+			if tt.leaked != "" && strings.Contains(got, tt.leaked) {
+				t.Errorf("Redact() = %q, still contains %q", got, tt.leaked)
+			}
+			if !strings.Contains(got, tt.present) {
+				t.Errorf("Redact() = %q, want it to contain %q", got, tt.present)
+			}
+		})
+	}
+}
+
+func TestRedactingWriter_JSONLogger(t *testing.T) {
+	RegisterSecret("another-secret")
+
+	var buf bytes.Buffer
+	logger := log.NewWithOptions(NewRedactingWriter(&buf), log.Options{Formatter: log.JSONFormatter})
+	logger.Error("Failed to refresh Rackspace token", "error", "identity rejected another-secret")
+
+	if strings.Contains(buf.String(), "another-secret") {
+		t.Fatalf("secret leaked into log output: %s", buf.String())
+	}
+	if !strings.Contains(buf.String(), `"msg":"Failed to refresh Rackspace token"`) {
+		t.Errorf("expected JSON log line, got %s", buf.String())
+	}
+}
+
+func TestSetup_RejectsInvalidSettings(t *testing.T) {
+	if err := Setup("verbose", "text"); err == nil {
+		t.Error("expected an error for an unknown level")
+	}
+	if err := Setup("info", "yaml"); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+}
@@ -0,0 +1,81 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "rackspace_webhook"
+
+// Registry holds every metric exported on the ops server's /metrics route.
+var Registry = prometheus.NewRegistry()
+
+var (
+	// APIRequests counts Cloud DNS and Identity API calls by operation and
+	// HTTP status code. Transport failures are recorded with code "error".
+	APIRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "api_requests_total",
+		Help:      "Rackspace API requests by operation and status code.",
+	}, []string{"operation", "code"})
+
+	// RecordsDuration tracks how long a full Records listing takes.
+	RecordsDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "records_duration_seconds",
+		Help:      "Time taken to list all managed records.",
+		Buckets:   []float64{0.1, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300},
+	})
+
+	// ApplyChangesDuration tracks how long applying one change set takes.
+	ApplyChangesDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "apply_changes_duration_seconds",
+		Help:      "Time taken to apply a set of record changes.",
+		Buckets:   []float64{0.1, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300},
+	})
+
+	// RecordChanges counts records written to Cloud DNS by action
+	// (created, updated, deleted) and record type.
+	RecordChanges = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "record_changes_total",
+		Help:      "Records created, updated or deleted by record type.",
+	}, []string{"action", "type"})
+
+	// TokenRefreshes counts token refresh attempts by result (success, failure).
+	TokenRefreshes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "token_refreshes_total",
+		Help:      "Rackspace Identity token refresh attempts by result.",
+	}, []string{"result"})
+
+	// ManagedDomains is the number of Cloud DNS domains matching the domain
+	// filter, per Rackspace account.
+	ManagedDomains = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "managed_domains",
+		Help:      "Number of Cloud DNS domains managed by this webhook.",
+	}, []string{"account"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		APIRequests,
+		RecordsDuration,
+		ApplyChangesDuration,
+		RecordChanges,
+		TokenRefreshes,
+		ManagedDomains,
+	)
+}
+
+// Handler serves the registry in the Prometheus exposition format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
@@ -0,0 +1,19 @@
+package middleware
+
+import (
+	"github.com/labstack/echo/v4"
+	echoMiddleware "github.com/labstack/echo/v4/middleware"
+
+	"github.com/rackerlabs/external-dns-rackspace-webhook/internal/logging"
+)
+
+// RequestIDMiddleware reuses the caller's X-Request-Id or generates one,
+// echoes it in the response header and stores it in the request context so
+// provider logs and error bodies can be correlated with the request.
+func RequestIDMiddleware() echo.MiddlewareFunc {
+	return echoMiddleware.RequestIDWithConfig(echoMiddleware.RequestIDConfig{
+		RequestIDHandler: func(c echo.Context, id string) {
+			c.SetRequest(c.Request().WithContext(logging.WithRequestID(c.Request().Context(), id)))
+		},
+	})
+}
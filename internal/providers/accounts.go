@@ -0,0 +1,384 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/charmbracelet/log"
+	"sigs.k8s.io/yaml"
+
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+// defaultAccountName labels the single account configured through
+// RACKSPACE_USERNAME and RACKSPACE_API_KEY.
+const defaultAccountName = "default"
+
+// Provider is what the webhook handlers need from a DNS provider. It is
+// implemented by RackspaceProvider for a single account and by
+// MultiAccountProvider when domains are spread across several accounts.
+type Provider interface {
+	Records(ctx context.Context) ([]*endpoint.Endpoint, error)
+	ApplyChanges(ctx context.Context, changes *plan.Changes) error
+	AdjustTTL(ep *endpoint.Endpoint)
+	GetDomainFilter() endpoint.DomainFilterInterface
+	Readiness() Readiness
+	WatchCredentials(ctx context.Context)
+	RunTokenRefresher(ctx context.Context)
+}
+
+// AccountConfig is one set of Rackspace credentials and the domain suffixes
+// whose zones live in that account.
+type AccountConfig struct {
+	Name         string   `json:"name"`
+	Domains      []string `json:"domains"`
+	Username     string   `json:"username,omitempty"`
+	APIKey       string   `json:"apiKey,omitempty"`
+	UsernameFile string   `json:"usernameFile,omitempty"`
+	APIKeyFile   string   `json:"apiKeyFile,omitempty"`
+	TenantID     string   `json:"tenantID,omitempty"`
+	// IdentityPreset ("us" or "uk") or IdentityEndpoint, and Region,
+	// replace the global settings for this account.
+	IdentityPreset   string `json:"identityPreset,omitempty"`
+	IdentityEndpoint string `json:"identityEndpoint,omitempty"`
+	Region           string `json:"region,omitempty"`
+	// DNSEndpoint bypasses the service catalog for this account. It carries
+	// the account's tenant number, so it is never shared between accounts.
+	DNSEndpoint string `json:"dnsEndpoint,omitempty"`
+}
+
+type accountsFile struct {
+	Accounts []AccountConfig `json:"accounts"`
+}
+
+// LoadAccounts reads a YAML or JSON accounts file. Credential files are read
+// here so a broken mount fails at startup rather than on first use.
+func LoadAccounts(path string) ([]AccountConfig, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read accounts file %s: %w", path, err)
+	}
+	var file accountsFile
+	if err := yaml.UnmarshalStrict(b, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse accounts file %s: %w", path, err)
+	}
+	if len(file.Accounts) == 0 {
+		return nil, fmt.Errorf("accounts file %s defines no accounts", path)
+	}
+
+	names := map[string]bool{}
+	owners := map[string]string{}
+	for i := range file.Accounts {
+		account := &file.Accounts[i]
+		if account.Name == "" {
+			return nil, fmt.Errorf("account %d has no name", i+1)
+		}
+		if names[account.Name] {
+			return nil, fmt.Errorf("account %q is defined more than once", account.Name)
+		}
+		names[account.Name] = true
+
+		if len(account.Domains) == 0 {
+			return nil, fmt.Errorf("account %q has no domains", account.Name)
+		}
+		for j, domain := range account.Domains {
+			domain = normalizeDomain(domain)
+			if domain == "" {
+				return nil, fmt.Errorf("account %q has an empty domain", account.Name)
+			}
+			if owner, ok := owners[domain]; ok {
+				return nil, fmt.Errorf("domain %q is assigned to both %q and %q", domain, owner, account.Name)
+			}
+			owners[domain] = account.Name
+			account.Domains[j] = domain
+		}
+
+		if account.UsernameFile != "" {
+			if account.Username, err = ReadCredentialFile(account.UsernameFile); err != nil {
+				return nil, fmt.Errorf("account %q: %w", account.Name, err)
+			}
+		}
+		if account.APIKeyFile != "" {
+			if account.APIKey, err = ReadCredentialFile(account.APIKeyFile); err != nil {
+				return nil, fmt.Errorf("account %q: %w", account.Name, err)
+			}
+		}
+		if account.Username == "" || account.APIKey == "" {
+			return nil, fmt.Errorf("account %q needs a username and an API key", account.Name)
+		}
+		if account.IdentityPreset != "" {
+			if account.IdentityEndpoint != "" {
+				return nil, fmt.Errorf("account %q sets both identityPreset and identityEndpoint", account.Name)
+			}
+			if account.IdentityEndpoint, err = IdentityEndpointForPreset(account.IdentityPreset); err != nil {
+				return nil, fmt.Errorf("account %q: %w", account.Name, err)
+			}
+		}
+		if account.DNSEndpoint != "" {
+			if u, err := url.Parse(account.DNSEndpoint); err != nil || u.Scheme == "" || u.Host == "" {
+				return nil, fmt.Errorf("account %q has an invalid dnsEndpoint %q: must be an absolute URL", account.Name, account.DNSEndpoint)
+			}
+		}
+	}
+	return file.Accounts, nil
+}
+
+// New returns a MultiAccountProvider when config.Accounts is set and a
+// single RackspaceProvider otherwise.
+func New(config *RackspaceConfig) (Provider, error) {
+	if len(config.Accounts) > 0 {
+		return NewMultiAccountProvider(config)
+	}
+	return NewRackspaceProvider(config)
+}
+
+// accountProvider is a RackspaceProvider together with the domain suffixes
+// it owns.
+type accountProvider struct {
+	name     string
+	domains  []string
+	provider *RackspaceProvider
+}
+
+// MultiAccountProvider spreads domains across several Rackspace accounts.
+// Each account keeps its own authenticated session, ServiceClient, cache and
+// rate limits; endpoints are routed to the account owning the longest
+// matching domain suffix.
+type MultiAccountProvider struct {
+	accounts     []*accountProvider
+	domainFilter *endpoint.DomainFilter
+	filterConfig RackspaceConfig
+}
+
+// NewMultiAccountProvider authenticates every account in config.Accounts.
+// The remaining settings in config apply to all of them, except the DNS
+// endpoint, which each account sets for itself.
+func NewMultiAccountProvider(config *RackspaceConfig) (*MultiAccountProvider, error) {
+	m := &MultiAccountProvider{}
+	var allDomains []string
+	for _, account := range config.Accounts {
+		accountConfig := accountConfigFor(config, account)
+		p, err := NewRackspaceProvider(&accountConfig)
+		if err != nil {
+			return nil, fmt.Errorf("account %q: %w", account.Name, err)
+		}
+		m.accounts = append(m.accounts, &accountProvider{name: account.Name, domains: account.Domains, provider: p})
+		allDomains = append(allDomains, account.Domains...)
+	}
+
+	// DOMAIN_FILTER and the regex filters still narrow what is managed;
+	// without them, the accounts' domains are the filter.
+	filterConfig := *config
+	if len(filterConfig.DomainFilter) == 0 {
+		filterConfig.DomainFilter = allDomains
+	}
+	m.filterConfig = filterConfig
+	m.domainFilter = newDomainFilter(&filterConfig)
+	log.Info("Initialized multi-account provider", "accounts", len(m.accounts), "domainFilter", m.domainFilter.Filters)
+	return m, nil
+}
+
+// accountConfigFor derives one account's settings from the global config.
+func accountConfigFor(config *RackspaceConfig, account AccountConfig) RackspaceConfig {
+	accountConfig := *config
+	accountConfig.Accounts = nil
+	accountConfig.AccountName = account.Name
+	accountConfig.Username = account.Username
+	accountConfig.APIKey = account.APIKey
+	accountConfig.UsernameFile = account.UsernameFile
+	accountConfig.APIKeyFile = account.APIKeyFile
+	accountConfig.TenantID = account.TenantID
+	// Regex filters would replace the account's domains, so they are
+	// only applied by the MultiAccountProvider's own filter.
+	accountConfig.DomainFilter = account.Domains
+	accountConfig.RegexDomainFilter = nil
+	accountConfig.RegexDomainExclusion = nil
+	if account.IdentityEndpoint != "" {
+		accountConfig.IdentityEndpoint = account.IdentityEndpoint
+	}
+	if account.Region != "" {
+		accountConfig.Region = account.Region
+	}
+	// A DNS endpoint names one tenant; without its own, an account uses
+	// its service catalog.
+	accountConfig.DNSEndpoint = account.DNSEndpoint
+	return accountConfig
+}
+
+// route returns the account owning dnsName, or nil when no account does.
+// Domains an account created are owned by that account.
+func (m *MultiAccountProvider) route(dnsName string) *accountProvider {
+	name := normalizeDomain(dnsName)
+	var best *accountProvider
+	bestLen := -1
+	for _, account := range m.accounts {
+		for _, domain := range append(slices.Clone(account.domains), account.provider.createdZoneNames()...) {
+			if (name == domain || strings.HasSuffix(name, "."+domain)) && len(domain) > bestLen {
+				best, bestLen = account, len(domain)
+			}
+		}
+	}
+	return best
+}
+
+// Records lists every account concurrently and merges the results. Any
+// failing account fails the whole listing, since a partial view would make
+// external-dns plan creates for records that already exist.
+func (m *MultiAccountProvider) Records(ctx context.Context) ([]*endpoint.Endpoint, error) {
+	results := make([][]*endpoint.Endpoint, len(m.accounts))
+	errs := make([]error, len(m.accounts))
+	var wg sync.WaitGroup
+	for i, account := range m.accounts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], errs[i] = account.provider.Records(ctx)
+			if errs[i] != nil {
+				errs[i] = fmt.Errorf("account %q: %w", account.name, errs[i])
+			}
+		}()
+	}
+	wg.Wait()
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	filter := m.negotiatedDomainFilter()
+	merged := map[string]*endpoint.Endpoint{}
+	var endpoints []*endpoint.Endpoint
+	for i, result := range results {
+		for _, ep := range result {
+			// A zone delegated to another account can show up in both;
+			// only the owning account's copy counts.
+			if owner := m.route(ep.DNSName); owner != m.accounts[i] || !filter.Match(ep.DNSName) {
+				continue
+			}
+			key := ep.DNSName + "/" + ep.RecordType
+			if existing, ok := merged[key]; ok {
+				existing.Targets = append(existing.Targets, ep.Targets...)
+				continue
+			}
+			merged[key] = ep
+			endpoints = append(endpoints, ep)
+		}
+	}
+	return endpoints, nil
+}
+
+// ApplyChanges splits changes by owning account and applies each account's
+// share. Endpoints outside every account are reported rather than dropped.
+func (m *MultiAccountProvider) ApplyChanges(ctx context.Context, changes *plan.Changes) error {
+	perAccount := map[*accountProvider]*plan.Changes{}
+	var errs []error
+	filter := m.negotiatedDomainFilter()
+	split := func(eps []*endpoint.Endpoint, add func(*plan.Changes, *endpoint.Endpoint)) {
+		for _, ep := range eps {
+			if !filter.Match(ep.DNSName) {
+				errs = append(errs, fmt.Errorf("%s is excluded by the domain filter", ep.DNSName))
+				continue
+			}
+			account := m.route(ep.DNSName)
+			if account == nil {
+				errs = append(errs, fmt.Errorf("no account manages %s", ep.DNSName))
+				continue
+			}
+			if perAccount[account] == nil {
+				perAccount[account] = &plan.Changes{}
+			}
+			add(perAccount[account], ep)
+		}
+	}
+	split(changes.Create, func(c *plan.Changes, ep *endpoint.Endpoint) { c.Create = append(c.Create, ep) })
+	split(changes.UpdateOld, func(c *plan.Changes, ep *endpoint.Endpoint) { c.UpdateOld = append(c.UpdateOld, ep) })
+	split(changes.UpdateNew, func(c *plan.Changes, ep *endpoint.Endpoint) { c.UpdateNew = append(c.UpdateNew, ep) })
+	split(changes.Delete, func(c *plan.Changes, ep *endpoint.Endpoint) { c.Delete = append(c.Delete, ep) })
+
+	for _, account := range m.accounts {
+		accountChanges, ok := perAccount[account]
+		if !ok {
+			continue
+		}
+		if err := account.provider.ApplyChanges(ctx, accountChanges); err != nil {
+			errs = append(errs, fmt.Errorf("account %q: %w", account.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// AdjustTTL applies the TTL policy of the account owning ep.
+func (m *MultiAccountProvider) AdjustTTL(ep *endpoint.Endpoint) {
+	account := m.route(ep.DNSName)
+	if account == nil {
+		account = m.accounts[0]
+	}
+	account.provider.AdjustTTL(ep)
+}
+
+// GetDomainFilter returns the filter negotiated with external-dns.
+func (m *MultiAccountProvider) GetDomainFilter() endpoint.DomainFilterInterface {
+	return m.negotiatedDomainFilter()
+}
+
+// negotiatedDomainFilter returns the domain filter extended with the
+// domains created by any account.
+func (m *MultiAccountProvider) negotiatedDomainFilter() *endpoint.DomainFilter {
+	var created []string
+	for _, account := range m.accounts {
+		created = append(created, account.provider.createdZoneNames()...)
+	}
+	if len(created) == 0 {
+		return m.domainFilter
+	}
+	config := m.filterConfig
+	config.DomainFilter = append(slices.Clone(config.DomainFilter), created...)
+	return newDomainFilter(&config)
+}
+
+// Readiness is ready only when every account is. Checks are prefixed with
+// the account name, and token status is reported per account.
+func (m *MultiAccountProvider) Readiness() Readiness {
+	readiness := Readiness{Ready: true, Checks: map[string]ReadinessCheck{}, Accounts: map[string]TokenStatus{}}
+	for _, account := range m.accounts {
+		r := account.provider.Readiness()
+		readiness.Ready = readiness.Ready && r.Ready
+		for name, check := range r.Checks {
+			readiness.Checks[account.name+"/"+name] = check
+		}
+		readiness.Accounts[account.name] = r.Token
+	}
+	return readiness
+}
+
+// WatchCredentials watches every account's credential files until ctx is done.
+func (m *MultiAccountProvider) WatchCredentials(ctx context.Context) {
+	m.each(func(p *RackspaceProvider) { p.WatchCredentials(ctx) })
+}
+
+// RunTokenRefresher renews every account's token until ctx is done.
+func (m *MultiAccountProvider) RunTokenRefresher(ctx context.Context) {
+	m.each(func(p *RackspaceProvider) { p.RunTokenRefresher(ctx) })
+}
+
+// each runs fn for every account concurrently and waits for all of them.
+func (m *MultiAccountProvider) each(fn func(*RackspaceProvider)) {
+	var wg sync.WaitGroup
+	for _, account := range m.accounts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			fn(account.provider)
+		}()
+	}
+	wg.Wait()
+}
+
+func normalizeDomain(name string) string {
+	return strings.ToLower(strings.TrimSuffix(strings.TrimSpace(name), "."))
+}
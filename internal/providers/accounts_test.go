@@ -0,0 +1,242 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	th "github.com/gophercloud/gophercloud/v2/testhelper"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+// fakeAccount serves one Cloud DNS domain and records the names written to it.
+type fakeAccount struct {
+	server  *th.FakeServer
+	mu      sync.Mutex
+	created []string
+}
+
+func newFakeAccount(t *testing.T, domainID, domainName, records string) *fakeAccount {
+	t.Helper()
+	server := th.SetupHTTP()
+	t.Cleanup(server.Teardown)
+	a := &fakeAccount{server: &server}
+	server.Mux.HandleFunc("/domains", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprintf(w, `{"domains":[{"id":%q,"name":%q}]}`, domainID, domainName)
+	})
+	server.Mux.HandleFunc("/domains/"+domainID+"/records", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == http.MethodPost {
+			a.mu.Lock()
+			a.created = append(a.created, r.URL.Path)
+			a.mu.Unlock()
+			w.WriteHeader(http.StatusAccepted)
+			_, _ = fmt.Fprint(w, `{"status":"COMPLETED","response":{"records":[{"id":"new"}]}}`)
+			return
+		}
+		_, _ = fmt.Fprintf(w, `{"records":[%s]}`, records)
+	})
+	return a
+}
+
+func newTestAccountProvider(t *testing.T, name string, domains []string, a *fakeAccount) *accountProvider {
+	t.Helper()
+	p := newTestProvider(t, a.server.Endpoint())
+	p.config.AccountName = name
+	p.DomainFilter = endpoint.NewDomainFilter(domains)
+	return &accountProvider{name: name, domains: domains, provider: p}
+}
+
+func TestMultiAccountProvider_RecordsAndApplyChanges(t *testing.T) {
+	prod := newFakeAccount(t, "111", "example.com",
+		`{"id":"r1","name":"www.example.com","type":"A","data":"10.0.0.1","ttl":300}`)
+	dev := newFakeAccount(t, "222", "dev.example.com",
+		`{"id":"r2","name":"app.dev.example.com","type":"A","data":"10.0.1.1","ttl":300}`)
+
+	m := &MultiAccountProvider{
+		accounts: []*accountProvider{
+			newTestAccountProvider(t, "prod", []string{"example.com"}, prod),
+			newTestAccountProvider(t, "dev", []string{"dev.example.com"}, dev),
+		},
+		domainFilter: endpoint.NewDomainFilter([]string{"example.com", "dev.example.com", "example.org"}),
+	}
+
+	endpoints, err := m.Records(context.Background())
+	if err != nil {
+		t.Fatalf("Records() error: %v", err)
+	}
+	var names []string
+	for _, ep := range endpoints {
+		names = append(names, ep.DNSName)
+	}
+	sort.Strings(names)
+	if strings.Join(names, ",") != "app.dev.example.com,www.example.com" {
+		t.Errorf("expected records from both accounts, got %v", names)
+	}
+
+	changes := &plan.Changes{Create: []*endpoint.Endpoint{
+		{DNSName: "api.example.com", RecordType: "A", Targets: []string{"10.0.0.2"}},
+		{DNSName: "api.dev.example.com", RecordType: "A", Targets: []string{"10.0.1.2"}},
+	}}
+	if err := m.ApplyChanges(context.Background(), changes); err != nil {
+		t.Fatalf("ApplyChanges() error: %v", err)
+	}
+	if len(prod.created) != 1 || prod.created[0] != "/domains/111/records" {
+		t.Errorf("expected api.example.com to be created in prod, got %v", prod.created)
+	}
+	if len(dev.created) != 1 || dev.created[0] != "/domains/222/records" {
+		t.Errorf("expected api.dev.example.com to be created in dev, got %v", dev.created)
+	}
+
+	unmanaged := &plan.Changes{Create: []*endpoint.Endpoint{
+		{DNSName: "www.example.org", RecordType: "A", Targets: []string{"10.0.2.1"}},
+	}}
+	if err := m.ApplyChanges(context.Background(), unmanaged); err == nil || !strings.Contains(err.Error(), "no account manages") {
+		t.Errorf("expected an error for an unmanaged domain, got %v", err)
+	}
+}
+
+func TestMultiAccountProvider_CreatedZones(t *testing.T) {
+	preview := newFakeAccount(t, "333", "pr-7.preview.example.com", "")
+	account := newTestAccountProvider(t, "preview", []string{"app.pr-7.preview.example.com"}, preview)
+	account.provider.config.DomainFilter = account.domains
+	account.provider.config.ZoneCreation = ZoneCreation{Enabled: true, Email: "dns@example.com", Parents: []string{"preview.example.com"}}
+	// As if an earlier sync had created the domain for app.pr-7.
+	account.provider.rememberCreatedZones([]string{"pr-7.preview.example.com"})
+
+	m := &MultiAccountProvider{
+		accounts:     []*accountProvider{account},
+		domainFilter: endpoint.NewDomainFilter(account.domains),
+		filterConfig: RackspaceConfig{DomainFilter: account.domains},
+	}
+	if !m.GetDomainFilter().Match("pr-7.preview.example.com") {
+		t.Error("expected the created domain to be negotiated with external-dns")
+	}
+	if got := m.route("www.pr-7.preview.example.com"); got != account {
+		t.Errorf("expected the created domain to be routed to its account, got %v", got)
+	}
+
+	changes := &plan.Changes{Create: []*endpoint.Endpoint{
+		{DNSName: "www.pr-7.preview.example.com", RecordType: "A", Targets: []string{"10.0.0.3"}},
+	}}
+	if err := m.ApplyChanges(context.Background(), changes); err != nil {
+		t.Fatalf("ApplyChanges() error: %v", err)
+	}
+	if len(preview.created) != 1 {
+		t.Errorf("expected www.pr-7.preview.example.com to be written to the created domain, got %v", preview.created)
+	}
+}
+
+func TestMultiAccountProvider_Route(t *testing.T) {
+	prod := &accountProvider{name: "prod", domains: []string{"example.com"}, provider: &RackspaceProvider{}}
+	dev := &accountProvider{name: "dev", domains: []string{"dev.example.com"}, provider: &RackspaceProvider{}}
+	m := &MultiAccountProvider{accounts: []*accountProvider{prod, dev}}
+
+	tests := map[string]*accountProvider{
+		"example.com":          prod,
+		"www.example.com":      prod,
+		"dev.example.com":      dev,
+		"app.dev.example.com.": dev,
+		"APP.DEV.EXAMPLE.COM":  dev,
+		"notdev.example.com":   prod,
+		"example.org":          nil,
+		"badexample.com":       nil,
+	}
+	for name, want := range tests {
+		if got := m.route(name); got != want {
+			t.Errorf("route(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestLoadAccounts(t *testing.T) {
+	dir := t.TempDir()
+	apiKeyFile := filepath.Join(dir, "api-key")
+	writeCredential(t, apiKeyFile, "dev-key")
+
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{
+			name: "valid",
+			content: `accounts:
+  - name: prod
+    domains: [example.com]
+    username: prod-user
+    apiKey: prod-key
+  - name: dev
+    domains: [Dev.Example.com.]
+    username: dev-user
+    apiKeyFile: ` + apiKeyFile + `
+`,
+		},
+		{name: "no accounts", content: `accounts: []`, wantErr: "no accounts"},
+		{name: "missing name", content: `{"accounts":[{"domains":["example.com"],"username":"u","apiKey":"k"}]}`, wantErr: "has no name"},
+		{
+			name:    "duplicate name",
+			content: `{"accounts":[{"name":"a","domains":["a.com"],"username":"u","apiKey":"k"},{"name":"a","domains":["b.com"],"username":"u","apiKey":"k"}]}`,
+			wantErr: "more than once",
+		},
+		{
+			name:    "domain in two accounts",
+			content: `{"accounts":[{"name":"a","domains":["a.com"],"username":"u","apiKey":"k"},{"name":"b","domains":["A.com"],"username":"u","apiKey":"k"}]}`,
+			wantErr: "assigned to both",
+		},
+		{name: "no domains", content: `{"accounts":[{"name":"a","username":"u","apiKey":"k"}]}`, wantErr: "has no domains"},
+		{name: "no api key", content: `{"accounts":[{"name":"a","domains":["a.com"],"username":"u"}]}`, wantErr: "needs a username and an API key"},
+		{name: "relative dns endpoint", content: `{"accounts":[{"name":"a","domains":["a.com"],"username":"u","apiKey":"k","dnsEndpoint":"dns.example.net/v1.0/1"}]}`, wantErr: "invalid dnsEndpoint"},
+		{name: "unknown field", content: `{"accounts":[{"name":"a","domains":["a.com"],"username":"u","apiToken":"k"}]}`, wantErr: "failed to parse"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, "accounts.yaml")
+			if err := os.WriteFile(path, []byte(tt.content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			accounts, err := LoadAccounts(path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadAccounts() error: %v", err)
+			}
+			if len(accounts) != 2 || accounts[1].APIKey != "dev-key" || accounts[1].Domains[0] != "dev.example.com" {
+				t.Errorf("unexpected accounts: %+v", accounts)
+			}
+		})
+	}
+}
+
+func TestAccountConfigFor_DNSEndpoint(t *testing.T) {
+	global := &RackspaceConfig{
+		Username:    "global",
+		APIKey:      "global-key",
+		DNSEndpoint: "https://dns.api.rackspacecloud.com/v1.0/111111",
+	}
+
+	shared := accountConfigFor(global, AccountConfig{Name: "dev", Domains: []string{"dev.example.com"}, Username: "u", APIKey: "k"})
+	if shared.DNSEndpoint != "" {
+		t.Errorf("expected the global DNS endpoint not to be shared with an account, got %q", shared.DNSEndpoint)
+	}
+
+	own := accountConfigFor(global, AccountConfig{Name: "prod", Domains: []string{"example.com"}, Username: "u", APIKey: "k", DNSEndpoint: "https://dns.api.rackspacecloud.com/v1.0/222222"})
+	if own.DNSEndpoint != "https://dns.api.rackspacecloud.com/v1.0/222222" {
+		t.Errorf("expected the account's own DNS endpoint, got %q", own.DNSEndpoint)
+	}
+	if own.AccountName != "prod" || own.Username != "u" || len(own.Accounts) != 0 {
+		t.Errorf("unexpected account config: %+v", own)
+	}
+}
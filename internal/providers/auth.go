@@ -2,12 +2,70 @@ package providers
 
 import (
 	"context"
+	"fmt"
+	"strings"
 
 	"github.com/gophercloud/gophercloud/v2"
+	"github.com/gophercloud/gophercloud/v2/openstack"
 	"github.com/rackerlabs/goclouddns"
 	"github.com/rackerlabs/goraxauth"
 )
 
+// dnsServiceType is the Cloud DNS entry in the Rackspace service catalog.
+const dnsServiceType = "rax:dns"
+
+// identityPresets maps account locations to their Rackspace Identity
+// endpoints. Accounts created in the UK authenticate against LON.
+var identityPresets = map[string]string{
+	"us":  "https://identity.api.rackspacecloud.com/v2.0/",
+	"uk":  "https://lon.identity.api.rackspacecloud.com/v2.0/",
+	"lon": "https://lon.identity.api.rackspacecloud.com/v2.0/",
+}
+
+// IdentityEndpointForPreset returns the Identity endpoint for a preset name
+// such as "us" or "uk".
+func IdentityEndpointForPreset(preset string) (string, error) {
+	endpoint, ok := identityPresets[strings.ToLower(strings.TrimSpace(preset))]
+	if !ok {
+		return "", fmt.Errorf("unknown identity preset %q: must be one of us, uk, lon", preset)
+	}
+	return endpoint, nil
+}
+
+// ParseAvailability validates a service catalog interface name.
+func ParseAvailability(value string) (gophercloud.Availability, error) {
+	switch availability := gophercloud.Availability(strings.ToLower(strings.TrimSpace(value))); availability {
+	case "", gophercloud.AvailabilityPublic, gophercloud.AvailabilityInternal:
+		return availability, nil
+	default:
+		return "", fmt.Errorf("unknown availability %q: must be public or internal", value)
+	}
+}
+
+// createDNSClient returns a Cloud DNS client for an authenticated provider.
+// DNSEndpoint skips the service catalog; otherwise the catalog entry is
+// selected by Region and Availability.
+func createDNSClient(authProvider AuthProvider, provider *gophercloud.ProviderClient, config *RackspaceConfig) (*gophercloud.ServiceClient, error) {
+	if config.DNSEndpoint != "" {
+		return &gophercloud.ServiceClient{
+			ProviderClient: provider,
+			Endpoint:       gophercloud.NormalizeURL(config.DNSEndpoint),
+			Type:           dnsServiceType,
+		}, nil
+	}
+
+	opts := gophercloud.EndpointOpts{Region: config.Region, Availability: config.Availability}
+	client, err := authProvider.CreateDNSClient(provider, opts)
+	if err != nil {
+		return nil, err
+	}
+	if client.Endpoint == "" {
+		opts.ApplyDefaults(dnsServiceType)
+		return nil, fmt.Errorf("service catalog has no %s Cloud DNS endpoint in region %q", opts.Availability, opts.Region)
+	}
+	return client, nil
+}
+
 // AuthProvider interface abstracts the authentication process
 type AuthProvider interface {
 	Authenticate(ctx context.Context, opts goraxauth.AuthOptions) (*gophercloud.ProviderClient, error)
@@ -20,8 +78,19 @@ func NewRackspaceAuthProvider() *RackspaceAuthProvider {
 	return &RackspaceAuthProvider{}
 }
 
+// Authenticate is goraxauth.AuthenticatedClient with the instrumented
+// transport installed before the Identity call, so authentications are
+// counted along with the Cloud DNS calls the client makes later.
 func (r *RackspaceAuthProvider) Authenticate(ctx context.Context, opts goraxauth.AuthOptions) (*gophercloud.ProviderClient, error) {
-	return goraxauth.AuthenticatedClient(ctx, opts)
+	client, err := openstack.NewClient(opts.IdentityEndpoint)
+	if err != nil {
+		return nil, err
+	}
+	client.HTTPClient.Transport = newInstrumentedTransport(client.HTTPClient.Transport)
+	if err := openstack.AuthenticateV2(ctx, client, opts, gophercloud.EndpointOpts{}); err != nil {
+		return nil, err
+	}
+	return client, nil
 }
 
 func (r *RackspaceAuthProvider) CreateDNSClient(provider *gophercloud.ProviderClient, opts gophercloud.EndpointOpts) (*gophercloud.ServiceClient, error) {
@@ -0,0 +1,187 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gophercloud/gophercloud/v2"
+	th "github.com/gophercloud/gophercloud/v2/testhelper"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+func TestApplyChanges_ReauthenticatesOnRevokedToken(t *testing.T) {
+	fakeServer := th.SetupHTTP()
+	defer fakeServer.Teardown()
+
+	var mu sync.Mutex
+	revoked := map[string]bool{}
+	var writeTokens []string
+	authorized := func(w http.ResponseWriter, r *http.Request) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		if revoked[r.Header.Get("X-Auth-Token")] {
+			w.WriteHeader(http.StatusUnauthorized)
+			return false
+		}
+		return true
+	}
+
+	fakeServer.Mux.HandleFunc("/domains", func(w http.ResponseWriter, r *http.Request) {
+		if !authorized(w, r) {
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprint(w, `{"domains":[{"id":"111","name":"example.com"}]}`)
+		// The token is revoked after the domain lookup, in the middle of ApplyChanges.
+		mu.Lock()
+		revoked[r.Header.Get("X-Auth-Token")] = true
+		mu.Unlock()
+	})
+	fakeServer.Mux.HandleFunc("/domains/111/records", func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, "POST")
+		mu.Lock()
+		writeTokens = append(writeTokens, r.Header.Get("X-Auth-Token"))
+		mu.Unlock()
+		if !authorized(w, r) {
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		_, _ = fmt.Fprint(w, `{"status":"COMPLETED","response":{"records":[{"id":"r1"}]}}`)
+	})
+
+	auth := &fakeAuthProvider{endpoint: fakeServer.Endpoint(), expiresIn: 4 * time.Hour}
+	config := &RackspaceConfig{IdentityEndpoint: fakeServer.Endpoint(), Username: "user", APIKey: "key"}
+	p := &RackspaceProvider{
+		authProvider: auth,
+		config:       config,
+		DomainFilter: endpoint.NewDomainFilter([]string{"example.com"}),
+	}
+	client, tokenExpiry, err := authenticateAndCreateClient(context.Background(), auth, config, p.recordReauth)
+	if err != nil {
+		t.Fatalf("authenticateAndCreateClient() error: %v", err)
+	}
+	p.tokenExpiry = tokenExpiry
+	p.serviceClient = p.newServiceClient(client)
+	// Earlier background renewals had been failing.
+	p.lastAuthErr = fmt.Errorf("503 Service Unavailable")
+	p.refresh.failures = 2
+	// The replacement token is issued with a shorter lifetime.
+	auth.expiresIn = 2 * time.Hour
+
+	changes := &plan.Changes{Create: []*endpoint.Endpoint{
+		{DNSName: "www.example.com", RecordType: "A", Targets: []string{"10.0.0.1"}},
+	}}
+	if err := p.ApplyChanges(context.Background(), changes); err != nil {
+		t.Fatalf("ApplyChanges() error: %v", err)
+	}
+
+	if len(auth.attempts) != 2 {
+		t.Errorf("expected one re-authentication, got %d authentications", len(auth.attempts))
+	}
+	if len(writeTokens) != 2 || writeTokens[0] != "token-1" || writeTokens[1] != "token-2" {
+		t.Errorf("expected the create to be replayed with the new token, got %v", writeTokens)
+	}
+	status := p.TokenStatus()
+	if status.ExpiresAt.After(time.Now().Add(2*time.Hour)) || status.LastRefresh.IsZero() || status.ConsecutiveFailures != 0 {
+		t.Errorf("expected the token status to follow the re-authentication, got %+v", status)
+	}
+	if !p.Readiness().Ready {
+		t.Errorf("expected the re-authentication to clear the failed renewal, got %+v", p.Readiness().Checks)
+	}
+}
+
+func TestApplyChanges_FailsWhenReauthenticationIsRejected(t *testing.T) {
+	fakeServer := th.SetupHTTP()
+	defer fakeServer.Teardown()
+
+	fakeServer.Mux.HandleFunc("/domains", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	})
+
+	auth := &fakeAuthProvider{endpoint: fakeServer.Endpoint()}
+	config := &RackspaceConfig{IdentityEndpoint: fakeServer.Endpoint(), Username: "user", APIKey: "key"}
+	p := &RackspaceProvider{
+		authProvider: auth,
+		config:       config,
+		DomainFilter: endpoint.NewDomainFilter([]string{"example.com"}),
+	}
+	client, tokenExpiry, err := authenticateAndCreateClient(context.Background(), auth, config, p.recordReauth)
+	if err != nil {
+		t.Fatalf("authenticateAndCreateClient() error: %v", err)
+	}
+	p.tokenExpiry = tokenExpiry
+	p.serviceClient = p.newServiceClient(client)
+	// The key is revoked along with the token.
+	auth.reject = map[string]bool{"key": true}
+
+	if _, err := p.Records(context.Background()); err == nil {
+		t.Fatal("expected Records() to fail")
+	}
+	if len(auth.attempts) != 2 {
+		t.Errorf("expected a single re-authentication attempt, got %d authentications", len(auth.attempts))
+	}
+	if readiness := p.Readiness(); readiness.Checks["authentication"].OK || readiness.Token.ConsecutiveFailures != 1 {
+		t.Errorf("expected readiness to report the failed re-authentication, got %+v", readiness)
+	}
+}
+
+func TestCreateDNSClient(t *testing.T) {
+	provider := &gophercloud.ProviderClient{TokenID: "token"}
+
+	t.Run("catalog lookup uses region and availability", func(t *testing.T) {
+		auth := &fakeAuthProvider{endpoint: "https://dns.example.test/v1.0/123/"}
+		config := &RackspaceConfig{Region: "LON", Availability: gophercloud.AvailabilityInternal}
+		client, err := createDNSClient(auth, provider, config)
+		if err != nil {
+			t.Fatalf("createDNSClient() error: %v", err)
+		}
+		if client.Endpoint != auth.endpoint {
+			t.Errorf("expected the catalog endpoint, got %q", client.Endpoint)
+		}
+		if len(auth.endpointOpts) != 1 || auth.endpointOpts[0].Region != "LON" || auth.endpointOpts[0].Availability != gophercloud.AvailabilityInternal {
+			t.Errorf("unexpected endpoint options: %+v", auth.endpointOpts)
+		}
+	})
+
+	t.Run("missing catalog entry", func(t *testing.T) {
+		auth := &fakeAuthProvider{}
+		if _, err := createDNSClient(auth, provider, &RackspaceConfig{Region: "SYD"}); err == nil || !strings.Contains(err.Error(), `public Cloud DNS endpoint in region "SYD"`) {
+			t.Errorf("expected a missing endpoint error, got %v", err)
+		}
+	})
+
+	t.Run("endpoint override skips the catalog", func(t *testing.T) {
+		auth := &fakeAuthProvider{endpoint: "https://dns.example.test/"}
+		client, err := createDNSClient(auth, provider, &RackspaceConfig{DNSEndpoint: "http://localhost:9000/v1.0/123"})
+		if err != nil {
+			t.Fatalf("createDNSClient() error: %v", err)
+		}
+		if client.Endpoint != "http://localhost:9000/v1.0/123/" || client.ProviderClient != provider {
+			t.Errorf("expected the override endpoint, got %q", client.Endpoint)
+		}
+		if len(auth.endpointOpts) != 0 {
+			t.Errorf("expected no catalog lookup, got %+v", auth.endpointOpts)
+		}
+	})
+}
+
+func TestIdentityEndpointForPreset(t *testing.T) {
+	for preset, want := range map[string]string{
+		"us": "https://identity.api.rackspacecloud.com/v2.0/",
+		"UK": "https://lon.identity.api.rackspacecloud.com/v2.0/",
+	} {
+		if got, err := IdentityEndpointForPreset(preset); err != nil || got != want {
+			t.Errorf("IdentityEndpointForPreset(%q) = %q, %v; want %q", preset, got, err, want)
+		}
+	}
+	if _, err := IdentityEndpointForPreset("syd"); err == nil {
+		t.Error("expected an error for an unknown preset")
+	}
+}
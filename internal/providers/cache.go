@@ -0,0 +1,241 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gophercloud/gophercloud/v2/pagination"
+	"github.com/rackerlabs/goclouddns/domains"
+	"github.com/rackerlabs/goclouddns/records"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/rackerlabs/external-dns-rackspace-webhook/internal/tracing"
+)
+
+// zoneCache holds the account's domain list and the records of each managed
+// zone so that ApplyChanges can resolve domains and existing records without
+// paging through the API for every endpoint. Records() refills it on every
+// sync; entries older than ttl are ignored. A nil cache or a zero ttl
+// disables caching entirely.
+type zoneCache struct {
+	mu        sync.Mutex
+	ttl       time.Duration
+	domains   []domains.DomainList
+	domainsAt time.Time
+	records   map[string]cachedZone
+}
+
+type cachedZone struct {
+	records []records.RecordList
+	at      time.Time
+}
+
+func newZoneCache(ttl time.Duration) *zoneCache {
+	return &zoneCache{ttl: ttl, records: map[string]cachedZone{}}
+}
+
+func (c *zoneCache) enabled() bool {
+	return c != nil && c.ttl > 0
+}
+
+func (c *zoneCache) getDomains() ([]domains.DomainList, bool) {
+	if !c.enabled() {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.domains == nil || time.Since(c.domainsAt) > c.ttl {
+		return nil, false
+	}
+	return append([]domains.DomainList(nil), c.domains...), true
+}
+
+func (c *zoneCache) setDomains(list []domains.DomainList) {
+	if !c.enabled() {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.domains = append([]domains.DomainList{}, list...)
+	c.domainsAt = time.Now()
+}
+
+func (c *zoneCache) getRecords(domainID string) ([]records.RecordList, bool) {
+	if !c.enabled() {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	zone, ok := c.records[domainID]
+	if !ok || time.Since(zone.at) > c.ttl {
+		return nil, false
+	}
+	return append([]records.RecordList(nil), zone.records...), true
+}
+
+func (c *zoneCache) setRecords(domainID string, list []records.RecordList) {
+	if !c.enabled() {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.records[domainID] = cachedZone{records: append([]records.RecordList{}, list...), at: time.Now()}
+}
+
+// invalidateDomains drops the cached domain list after a domain is created,
+// so the next lookup sees it.
+func (c *zoneCache) invalidateDomains() {
+	if !c.enabled() {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.domains = nil
+}
+
+// invalidateRecords drops the cached records of a zone after a write, so the
+// next lookup reads the zone back from Cloud DNS.
+func (c *zoneCache) invalidateRecords(domainID string) {
+	if !c.enabled() {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.records, domainID)
+}
+
+type writtenZonesKey struct{}
+
+// writtenZones collects the zones written during one ApplyChanges call.
+type writtenZones struct {
+	mu  sync.Mutex
+	ids map[string]bool
+}
+
+// withWrittenZones defers record cache invalidation for writes made with
+// the returned context until invalidateWritten is called. The changes in a
+// plan never touch the same name twice, so reads in between may use the
+// listing from Records.
+func withWrittenZones(ctx context.Context) (context.Context, *writtenZones) {
+	written := &writtenZones{ids: map[string]bool{}}
+	return context.WithValue(ctx, writtenZonesKey{}, written), written
+}
+
+// invalidateZone drops a zone's cached records after a write, or marks it
+// for invalidateWritten when ctx defers invalidation.
+func (p *RackspaceProvider) invalidateZone(ctx context.Context, domainID string) {
+	if written, ok := ctx.Value(writtenZonesKey{}).(*writtenZones); ok {
+		written.mu.Lock()
+		written.ids[domainID] = true
+		written.mu.Unlock()
+		return
+	}
+	p.cache.invalidateRecords(domainID)
+}
+
+// invalidateWritten drops the cached records of every zone written so far.
+// Zones written afterwards are collected again for the next call.
+func (p *RackspaceProvider) invalidateWritten(written *writtenZones) {
+	written.mu.Lock()
+	defer written.mu.Unlock()
+	for id := range written.ids {
+		p.cache.invalidateRecords(id)
+	}
+	clear(written.ids)
+}
+
+// listDomains returns every domain on the account, from the cache when it
+// is fresh and from Cloud DNS otherwise.
+func (p *RackspaceProvider) listDomains(ctx context.Context) ([]domains.DomainList, error) {
+	if cached, ok := p.cache.getDomains(); ok {
+		return cached, nil
+	}
+	return p.fetchDomains(ctx)
+}
+
+// fetchDomains pages through every domain on the account and refreshes the cache.
+func (p *RackspaceProvider) fetchDomains(ctx context.Context) (_ []domains.DomainList, err error) {
+	ctx, span := tracing.Start(ctx, "cloud_dns.list_domains", trace.WithSpanKind(trace.SpanKindClient))
+	defer func() { tracing.End(span, err) }()
+	var all []domains.DomainList
+	var created []string
+	list := func(client ServiceClient) pagination.Pager {
+		return client.ListDomains(ctx, domains.ListOpts{})
+	}
+	err = p.eachPageWithRetry(ctx, "list_domains", list, func() { all, created = nil, nil }, func(ctx context.Context, page pagination.Page) (bool, error) {
+		domainPage, ok := page.(domains.DomainPage)
+		if !ok {
+			return false, fmt.Errorf("unexpected page type %T listing domains", page)
+		}
+		domainList, err := domains.ExtractDomains(domainPage)
+		if err != nil {
+			return false, fmt.Errorf("failed to extract domains: %w", err)
+		}
+		all = append(all, domainList...)
+		// DomainList drops the comment, which marks the domains created by
+		// the webhook.
+		var commented struct {
+			Domains []struct {
+				Name    string `json:"name"`
+				Comment string `json:"comment"`
+			} `json:"domains"`
+		}
+		if err := domainPage.ExtractInto(&commented); err != nil {
+			return false, fmt.Errorf("failed to extract domains: %w", err)
+		}
+		for _, domain := range commented.Domains {
+			if domain.Comment == zoneComment {
+				created = append(created, domain.Name)
+			}
+		}
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	p.rememberCreatedZones(created)
+	span.SetAttributes(attribute.Int("dns.domain_count", len(all)))
+	p.cache.setDomains(all)
+	return all, nil
+}
+
+// listZoneRecords returns every record in a zone, from the cache when it is
+// fresh and from Cloud DNS otherwise.
+func (p *RackspaceProvider) listZoneRecords(ctx context.Context, domainID string) ([]records.RecordList, error) {
+	if cached, ok := p.cache.getRecords(domainID); ok {
+		return cached, nil
+	}
+	return p.fetchZoneRecords(ctx, domainID)
+}
+
+// fetchZoneRecords pages through every record in a zone and refreshes the cache.
+func (p *RackspaceProvider) fetchZoneRecords(ctx context.Context, domainID string) (_ []records.RecordList, err error) {
+	ctx, span := tracing.Start(ctx, "cloud_dns.list_records", trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(tracing.DomainIDKey.String(domainID)))
+	defer func() { tracing.End(span, err) }()
+	var all []records.RecordList
+	list := func(client ServiceClient) pagination.Pager {
+		return client.ListRecords(ctx, domainID, records.ListOpts{})
+	}
+	err = p.eachPageWithRetry(ctx, "list_records", list, func() { all = nil }, func(ctx context.Context, page pagination.Page) (bool, error) {
+		recordPage, ok := page.(records.RecordPage)
+		if !ok {
+			return false, fmt.Errorf("unexpected page type %T listing records", page)
+		}
+		recordList, err := records.ExtractRecords(recordPage)
+		if err != nil {
+			return false, fmt.Errorf("failed to extract records: %w", err)
+		}
+		all = append(all, recordList...)
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	span.SetAttributes(tracing.RecordCountKey.Int(len(all)))
+	p.cache.setRecords(domainID, all)
+	return all, nil
+}
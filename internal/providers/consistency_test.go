@@ -2,8 +2,10 @@ package providers
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"net/http"
+	"strings"
 	"testing"
 	"time"
 
@@ -34,7 +36,7 @@ func TestConvertRecordToEndpoint_NoTrailingDot(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			ep := convertRecordToEndpoint(tt.record, "example.com")
+			ep := convertRecordToEndpoint(context.Background(), tt.record, "example.com")
 			if ep == nil {
 				t.Fatal("convertRecordToEndpoint returned nil")
 			}
@@ -79,7 +81,7 @@ func TestConvertRecordToEndpoint_SRVFormat(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			ep := convertRecordToEndpoint(tt.record, "example.com")
+			ep := convertRecordToEndpoint(context.Background(), tt.record, "example.com")
 			if ep == nil {
 				t.Fatal("convertRecordToEndpoint returned nil")
 			}
@@ -111,7 +113,7 @@ func TestConvertRecordToEndpoint_TXTDataUnmodified(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			rec := records.RecordList{Name: "a-myhost.example.com", Type: "TXT", Data: tt.data, TTL: 300}
-			ep := convertRecordToEndpoint(rec, "example.com")
+			ep := convertRecordToEndpoint(context.Background(), rec, "example.com")
 			if ep == nil {
 				t.Fatal("convertRecordToEndpoint returned nil")
 			}
@@ -134,7 +136,7 @@ func TestConvertRecordToEndpoint_SkipsNSAndSOA(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			rec := records.RecordList{Name: "example.com", Type: tt.recordType, Data: "ns1.example.com", TTL: 300}
-			ep := convertRecordToEndpoint(rec, "example.com")
+			ep := convertRecordToEndpoint(context.Background(), rec, "example.com")
 			if ep != nil {
 				t.Errorf("expected nil for %s record, got %+v", tt.recordType, ep)
 			}
@@ -168,7 +170,7 @@ func TestConvertRecordToEndpoint_TXTLabels(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			rec := records.RecordList{Name: "txt.example.com", Type: "TXT", Data: "v=spf1", TTL: 300, Comment: tt.comment}
-			ep := convertRecordToEndpoint(rec, "example.com")
+			ep := convertRecordToEndpoint(context.Background(), rec, "example.com")
 			if ep == nil {
 				t.Fatal("convertRecordToEndpoint returned nil")
 			}
@@ -285,3 +287,138 @@ func newTestProvider(t *testing.T, serviceEndpoint string) *RackspaceProvider {
 		DryRun:       false,
 	}
 }
+
+func TestConvertRecordToEndpoint_MXFormat(t *testing.T) {
+	tests := []struct {
+		name       string
+		record     records.RecordList
+		wantTarget string
+	}{
+		{
+			name: "priority prepended to host",
+			record: records.RecordList{
+				Name: "example.com", Type: "MX",
+				Data: "mail.example.com", TTL: 300, Priority: 10,
+			},
+			wantTarget: "10 mail.example.com.",
+		},
+		{
+			name: "zero priority",
+			record: records.RecordList{
+				Name: "example.com", Type: "MX",
+				Data: "mx0.example.com", TTL: 300, Priority: 0,
+			},
+			wantTarget: "0 mx0.example.com.",
+		},
+		{
+			name: "host already fully qualified",
+			record: records.RecordList{
+				Name: "example.com", Type: "MX",
+				Data: "mx1.example.com.", TTL: 300, Priority: 20,
+			},
+			wantTarget: "20 mx1.example.com.",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ep := convertRecordToEndpoint(context.Background(), tt.record, "example.com")
+			if ep == nil {
+				t.Fatal("convertRecordToEndpoint returned nil")
+			}
+			if ep.Targets[0] != tt.wantTarget {
+				t.Errorf("MX target = %q, want %q", ep.Targets[0], tt.wantTarget)
+			}
+		})
+	}
+}
+
+func TestCreateRecord_MXSplitsPriority(t *testing.T) {
+	tests := []struct {
+		name         string
+		target       string
+		wantData     string
+		wantPriority float64
+		wantErr      bool
+	}{
+		{name: "host without trailing dot", target: "10 mail.example.com", wantData: "mail.example.com", wantPriority: 10},
+		{name: "host with trailing dot", target: "20 mx2.example.com.", wantData: "mx2.example.com", wantPriority: 20},
+		{name: "missing preference", target: "mail.example.com", wantErr: true},
+		{name: "non-numeric preference", target: "high mail.example.com", wantErr: true},
+		{name: "negative preference", target: "-1 mail.example.com", wantErr: true},
+		{name: "preference out of range", target: "65536 mail.example.com", wantErr: true},
+		// CreateOpts alone would drop a zero priority from the request.
+		{name: "zero preference", target: "0 mail.example.com", wantData: "mail.example.com", wantPriority: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakeServer := th.SetupHTTP()
+			defer fakeServer.Teardown()
+
+			fakeServer.Mux.HandleFunc("/domains", func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = fmt.Fprint(w, `{"domains":[{"id":"111","name":"example.com"}]}`)
+			})
+			var gotData string
+			var gotPriority *float64
+			fakeServer.Mux.HandleFunc("/domains/111/records", func(w http.ResponseWriter, r *http.Request) {
+				th.TestMethod(t, r, "POST")
+				var payload struct {
+					Records []struct {
+						Data     string   `json:"data"`
+						Priority *float64 `json:"priority"`
+					} `json:"records"`
+				}
+				if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+					t.Fatalf("failed to parse request body: %v", err)
+				}
+				if len(payload.Records) > 0 {
+					gotData = payload.Records[0].Data
+					gotPriority = payload.Records[0].Priority
+				}
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusAccepted)
+				_, _ = fmt.Fprint(w, `{"callbackUrl":"`+fakeServer.Endpoint()+`callback","status":"COMPLETED","response":{"records":[{"id":"r1"}]}}`)
+			})
+			fakeServer.Mux.HandleFunc("/callback", func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = fmt.Fprint(w, `{"status":"COMPLETED","response":{"records":[{"id":"r1"}]}}`)
+			})
+
+			p := newTestProvider(t, fakeServer.Endpoint())
+			ep := &endpoint.Endpoint{DNSName: "example.com", RecordType: "MX", Targets: []string{tt.target}, RecordTTL: 300}
+			err := p.createRecord(context.Background(), ep)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("createRecord() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if gotData != tt.wantData {
+				t.Errorf("MX data = %q, want %q", gotData, tt.wantData)
+			}
+			if gotPriority == nil || *gotPriority != tt.wantPriority {
+				t.Errorf("MX priority = %v, want %v", gotPriority, tt.wantPriority)
+			}
+		})
+	}
+}
+
+func TestBuildCreateOpts_SRVPriorityRange(t *testing.T) {
+	for _, target := range []string{"-1 5 443 svc.example.com.", "65536 5 443 svc.example.com."} {
+		ep := &endpoint.Endpoint{DNSName: "_https._tcp.example.com", RecordType: "SRV", Targets: []string{target}}
+		if _, err := buildCreateOpts(ep, target); err == nil {
+			t.Errorf("buildCreateOpts(%q) accepted an out-of-range priority", target)
+		}
+	}
+	ep := &endpoint.Endpoint{DNSName: "_https._tcp.example.com", RecordType: "SRV", Targets: []string{"0 5 443 svc.example.com."}}
+	opts, err := buildCreateOpts(ep, ep.Targets[0])
+	if err != nil || opts.Priority != 0 || opts.Data != "5 443 svc.example.com" {
+		t.Errorf("buildCreateOpts() = %+v, %v", opts, err)
+	}
+	b, _ := json.Marshal(newRecordBody(opts))
+	if !strings.Contains(string(b), `"priority":0`) {
+		t.Errorf("expected priority 0 in the request body, got %s", b)
+	}
+}
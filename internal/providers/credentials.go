@@ -0,0 +1,110 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/rackerlabs/external-dns-rackspace-webhook/internal/logging"
+)
+
+// credentialsPollInterval is how often mounted credential files are checked.
+// Kubernetes replaces Secret volumes through a symlink swap, which file
+// watches on the mounted path do not reliably report, so the files are
+// simply re-read.
+const credentialsPollInterval = 15 * time.Second
+
+// ReadCredentialFile returns the trimmed contents of a mounted Secret key.
+func ReadCredentialFile(path string) (string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read credential file %s: %w", path, err)
+	}
+	value := strings.TrimSpace(string(b))
+	if value == "" {
+		return "", fmt.Errorf("credential file %s is empty", path)
+	}
+	return value, nil
+}
+
+// WatchCredentials re-reads UsernameFile and APIKeyFile until ctx is done.
+// It returns immediately when neither is configured.
+func (p *RackspaceProvider) WatchCredentials(ctx context.Context) {
+	if p.config.UsernameFile == "" && p.config.APIKeyFile == "" {
+		return
+	}
+	logging.FromContext(ctx).Info("Watching credential files", "usernameFile", p.config.UsernameFile, "apiKeyFile", p.config.APIKeyFile, "interval", credentialsPollInterval)
+	ticker := time.NewTicker(credentialsPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := p.reloadCredentials(ctx); err != nil {
+				logging.FromContext(ctx).Error("Failed to reload credentials", "error", err)
+			}
+		}
+	}
+}
+
+// reloadCredentials re-authenticates when the credential files no longer
+// match the credentials in use, through the same shared, time-limited
+// refresh as token renewal. Calls already holding the previous client
+// finish with it. On failure the previous credentials stay in use and the
+// next poll tries again.
+func (p *RackspaceProvider) reloadCredentials(ctx context.Context) error {
+	p.mu.RLock()
+	current := credentials{username: p.config.Username, apiKey: p.config.APIKey}
+	usernameFile, apiKeyFile := p.config.UsernameFile, p.config.APIKeyFile
+	p.mu.RUnlock()
+
+	want := current
+	if usernameFile != "" {
+		username, err := ReadCredentialFile(usernameFile)
+		if err != nil {
+			return err
+		}
+		want.username = username
+	}
+	if apiKeyFile != "" {
+		apiKey, err := ReadCredentialFile(apiKeyFile)
+		if err != nil {
+			return err
+		}
+		want.apiKey = apiKey
+	}
+	if want == current {
+		return nil
+	}
+
+	logging.RegisterSecret(want.apiKey)
+	p.setCredentials(want)
+	used, err := p.authenticate(ctx)
+	if used != want {
+		// Joined a refresh that was already in flight with the previous
+		// credentials; authenticate again with the new ones.
+		used, err = p.authenticate(ctx)
+	}
+	if err != nil {
+		p.mu.Lock()
+		if (credentials{username: p.config.Username, apiKey: p.config.APIKey}) == want {
+			p.config.Username, p.config.APIKey = current.username, current.apiKey
+		}
+		p.mu.Unlock()
+		return err
+	}
+	logging.FromContext(ctx).Info("Reloaded Rackspace credentials", "username", used.username, "expiresAt", p.TokenStatus().ExpiresAt)
+	return nil
+}
+
+// setCredentials replaces the username and API key used by the next
+// authentication.
+func (p *RackspaceProvider) setCredentials(c credentials) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.config.Username = c.username
+	p.config.APIKey = c.apiKey
+}
@@ -0,0 +1,170 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gophercloud/gophercloud/v2"
+	"github.com/gophercloud/gophercloud/v2/openstack/identity/v2/tokens"
+	"github.com/rackerlabs/goraxauth"
+)
+
+// fakeAuthProvider records authentication attempts and catalog lookups,
+// issues the tokens token-1, token-2, ... in order and rejects API keys
+// listed in reject. When expiresIn is set, tokens carry an expiry that far
+// out; otherwise they have none.
+type fakeAuthProvider struct {
+	endpoint     string
+	reject       map[string]bool
+	expiresIn    time.Duration
+	attempts     []goraxauth.AuthOptions
+	endpointOpts []gophercloud.EndpointOpts
+}
+
+func (f *fakeAuthProvider) Authenticate(ctx context.Context, opts goraxauth.AuthOptions) (*gophercloud.ProviderClient, error) {
+	f.attempts = append(f.attempts, opts)
+	if f.reject[opts.ApiKey] {
+		return nil, errors.New("invalid credentials")
+	}
+	tokenID := fmt.Sprintf("token-%d", len(f.attempts))
+	if f.expiresIn == 0 {
+		return &gophercloud.ProviderClient{TokenID: tokenID}, nil
+	}
+	provider := &gophercloud.ProviderClient{}
+	err := provider.SetTokenAndAuthResult(tokens.CreateResult{Result: gophercloud.Result{Body: map[string]any{
+		"access": map[string]any{"token": map[string]any{
+			"id":      tokenID,
+			"expires": time.Now().Add(f.expiresIn).UTC().Format(gophercloud.RFC3339Milli),
+		}},
+	}}})
+	return provider, err
+}
+
+func (f *fakeAuthProvider) CreateDNSClient(provider *gophercloud.ProviderClient, opts gophercloud.EndpointOpts) (*gophercloud.ServiceClient, error) {
+	f.endpointOpts = append(f.endpointOpts, opts)
+	return &gophercloud.ServiceClient{ProviderClient: provider, Endpoint: f.endpoint}, nil
+}
+
+func writeCredential(t *testing.T, path, value string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(value+"\n"), 0o600); err != nil {
+		t.Fatalf("failed to write %s: %v", path, err)
+	}
+}
+
+func TestReloadCredentials(t *testing.T) {
+	dir := t.TempDir()
+	usernameFile := filepath.Join(dir, "username")
+	apiKeyFile := filepath.Join(dir, "api-key")
+	writeCredential(t, usernameFile, "user")
+	writeCredential(t, apiKeyFile, "key-1")
+
+	auth := &fakeAuthProvider{endpoint: "http://localhost/", reject: map[string]bool{"bad-key": true}}
+	p := &RackspaceProvider{
+		authProvider: auth,
+		tokenExpiry:  time.Now().Add(time.Hour),
+		config: &RackspaceConfig{
+			Username:     "user",
+			APIKey:       "key-1",
+			UsernameFile: usernameFile,
+			APIKeyFile:   apiKeyFile,
+		},
+	}
+	original := p.newServiceClient(FakeDNSClient("http://localhost/"))
+	p.serviceClient = original
+
+	// Unchanged files do not re-authenticate.
+	if err := p.reloadCredentials(context.Background()); err != nil {
+		t.Fatalf("reloadCredentials() error: %v", err)
+	}
+	if len(auth.attempts) != 0 {
+		t.Fatalf("expected no authentication, got %d attempts", len(auth.attempts))
+	}
+
+	// Rejected credentials keep the previous client and surface the error.
+	writeCredential(t, apiKeyFile, "bad-key")
+	if err := p.reloadCredentials(context.Background()); err == nil {
+		t.Fatal("expected reloadCredentials() to fail for rejected credentials")
+	}
+	if p.serviceClient != original || p.config.APIKey != "key-1" {
+		t.Error("expected the previous client and credentials to stay in use")
+	}
+	if p.Readiness().Ready {
+		t.Error("expected readiness to report the failed authentication")
+	}
+
+	// Rotated credentials re-authenticate and swap the client.
+	writeCredential(t, apiKeyFile, "key-2")
+	if err := p.reloadCredentials(context.Background()); err != nil {
+		t.Fatalf("reloadCredentials() error: %v", err)
+	}
+	if got := auth.attempts[len(auth.attempts)-1]; got.ApiKey != "key-2" || got.Username != "user" {
+		t.Errorf("expected authentication with the rotated key, got %+v", got)
+	}
+	if p.serviceClient == original {
+		t.Error("expected a new service client after rotation")
+	}
+	if p.config.APIKey != "key-2" || p.lastAuthErr != nil {
+		t.Errorf("expected rotated credentials to be active, got key %q err %v", p.config.APIKey, p.lastAuthErr)
+	}
+}
+
+func TestReloadCredentials_WaitsForRefreshInFlight(t *testing.T) {
+	dir := t.TempDir()
+	apiKeyFile := filepath.Join(dir, "api-key")
+	writeCredential(t, apiKeyFile, "key-2")
+
+	auth := &gatedAuthProvider{fakeAuthProvider: fakeAuthProvider{endpoint: "http://localhost/"}, release: make(chan struct{})}
+	p := newTokenTestProvider(auth, time.Now().Add(-time.Minute))
+	p.config.APIKey = "key-1"
+	p.config.APIKeyFile = apiKeyFile
+
+	// A renewal with the old key is still waiting on Identity when the
+	// rotated key is picked up.
+	refreshed := make(chan error, 1)
+	go func() { refreshed <- p.refreshToken(context.Background()) }()
+	time.Sleep(50 * time.Millisecond)
+	reloaded := make(chan error, 1)
+	go func() { reloaded <- p.reloadCredentials(context.Background()) }()
+	time.Sleep(50 * time.Millisecond)
+	close(auth.release)
+
+	if err := <-refreshed; err != nil {
+		t.Fatalf("refreshToken() error: %v", err)
+	}
+	if err := <-reloaded; err != nil {
+		t.Fatalf("reloadCredentials() error: %v", err)
+	}
+	auth.mu.Lock()
+	defer auth.mu.Unlock()
+	if len(auth.attempts) != 2 || auth.attempts[0].ApiKey != "key-1" || auth.attempts[1].ApiKey != "key-2" {
+		t.Errorf("expected the reload to authenticate after the old renewal finished, got %+v", auth.attempts)
+	}
+	if status := p.TokenStatus(); !status.ExpiresAt.After(time.Now()) || p.config.APIKey != "key-2" {
+		t.Errorf("expected the rotated key to be active, got key %q status %+v", p.config.APIKey, status)
+	}
+}
+
+func TestReadCredentialFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "api-key")
+	writeCredential(t, path, "  secret  ")
+
+	got, err := ReadCredentialFile(path)
+	if err != nil || got != "secret" {
+		t.Errorf("ReadCredentialFile() = %q, %v; want %q", got, err, "secret")
+	}
+
+	writeCredential(t, path, "")
+	if _, err := ReadCredentialFile(path); err == nil {
+		t.Error("expected an error for an empty file")
+	}
+	if _, err := ReadCredentialFile(filepath.Join(dir, "missing")); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
@@ -0,0 +1,139 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/rackerlabs/goclouddns/domains"
+	"github.com/rackerlabs/goclouddns/records"
+
+	"github.com/rackerlabs/external-dns-rackspace-webhook/internal/logging"
+)
+
+// delegationComment marks the NS records owned by the delegation manager.
+// Only records carrying it are ever removed, so delegations added by hand
+// are left alone.
+const delegationComment = "Delegation managed by external-dns-rackspace-webhook"
+
+// managedZone is a domain that passed the filters in Records, with the
+// records listed for it.
+type managedZone struct {
+	domain  domains.DomainList
+	records []records.RecordList
+}
+
+func (p *RackspaceProvider) delegationEnabled() bool {
+	return p.config != nil && p.config.ManageDelegations
+}
+
+// reconcileDelegations makes every managed parent domain delegate to its
+// managed child domains. For each child, the parent gets NS records at the
+// child's name matching the child's own apex NS records. Delegations this
+// manager added are removed once their child domain no longer exists on
+// the account or no longer lists that nameserver. all is every domain on the account; zones are the managed
+// ones.
+func (p *RackspaceProvider) reconcileDelegations(ctx context.Context, all []domains.DomainList, zones []managedZone) error {
+	exists := make(map[string]bool, len(all))
+	for _, domain := range all {
+		exists[normalizeDomain(domain.Name)] = true
+	}
+	// The apex nameservers of each managed domain, which its delegation
+	// should list.
+	apexNS := make(map[string]map[string]bool, len(zones))
+	for _, zone := range zones {
+		name := normalizeDomain(zone.domain.Name)
+		apexNS[name] = map[string]bool{}
+		for _, rec := range zone.records {
+			if rec.Type == "NS" && normalizeDomain(rec.Name) == name {
+				apexNS[name][normalizeDomain(rec.Data)] = true
+			}
+		}
+	}
+
+	var errs []error
+	for i := range zones {
+		parent := &zones[i]
+		parentName := normalizeDomain(parent.domain.Name)
+		var want []records.CreateOpts
+		var stale []records.RecordList
+
+		for j := range zones {
+			child := &zones[j]
+			if i == j || closestParent(zones, normalizeDomain(child.domain.Name)) != parent {
+				continue
+			}
+			want = append(want, missingDelegation(parent, child)...)
+		}
+		for _, rec := range parent.records {
+			name := normalizeDomain(rec.Name)
+			if rec.Type != "NS" || rec.Comment != delegationComment || name == parentName {
+				continue
+			}
+			// Stale once the child is gone or no longer uses the nameserver.
+			// A child outside the managed domains is left as it is.
+			if nameservers, managed := apexNS[name]; !exists[name] || (managed && !nameservers[normalizeDomain(rec.Data)]) {
+				stale = append(stale, rec)
+			}
+		}
+
+		if p.DryRun {
+			for _, opts := range want {
+				logging.FromContext(ctx).Info("Dry run: would add delegation", "parent", parent.domain.Name, "child", opts.Name, "nameserver", opts.Data)
+			}
+			for _, rec := range stale {
+				logging.FromContext(ctx).Info("Dry run: would remove delegation", "parent", parent.domain.Name, "child", rec.Name, "nameserver", rec.Data)
+			}
+			continue
+		}
+		if err := p.createInDomain(ctx, &parent.domain, want); err != nil {
+			errs = append(errs, fmt.Errorf("failed to add delegations in %s: %w", parent.domain.Name, err))
+		}
+		if err := p.deleteInDomain(ctx, &parent.domain, stale); err != nil {
+			errs = append(errs, fmt.Errorf("failed to remove delegations from %s: %w", parent.domain.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// closestParent returns the managed zone that most closely encloses name,
+// or nil when name is not below any of them.
+func closestParent(zones []managedZone, name string) *managedZone {
+	var best *managedZone
+	for i := range zones {
+		zoneName := normalizeDomain(zones[i].domain.Name)
+		if strings.HasSuffix(name, "."+zoneName) && (best == nil || len(zoneName) > len(normalizeDomain(best.domain.Name))) {
+			best = &zones[i]
+		}
+	}
+	return best
+}
+
+// missingDelegation returns the NS records the parent lacks for the child's
+// apex nameservers.
+func missingDelegation(parent, child *managedZone) []records.CreateOpts {
+	childName := normalizeDomain(child.domain.Name)
+	have := map[string]bool{}
+	for _, rec := range parent.records {
+		if rec.Type == "NS" && normalizeDomain(rec.Name) == childName {
+			have[normalizeDomain(rec.Data)] = true
+		}
+	}
+
+	var missing []records.CreateOpts
+	for _, rec := range child.records {
+		if rec.Type != "NS" || normalizeDomain(rec.Name) != childName || have[normalizeDomain(rec.Data)] {
+			continue
+		}
+		have[normalizeDomain(rec.Data)] = true
+		missing = append(missing, records.CreateOpts{
+			Name:    child.domain.Name,
+			Type:    "NS",
+			Data:    rec.Data,
+			TTL:     rec.TTL,
+			Comment: delegationComment,
+		})
+	}
+	return missing
+}
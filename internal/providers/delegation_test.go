@@ -0,0 +1,98 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"testing"
+
+	th "github.com/gophercloud/gophercloud/v2/testhelper"
+	"github.com/rackerlabs/goclouddns/records"
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+func TestRecords_ReconcilesDelegations(t *testing.T) {
+	fakeServer := th.SetupHTTP()
+	defer fakeServer.Teardown()
+
+	fakeServer.Mux.HandleFunc("/domains", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprint(w, `{"domains":[{"id":"111","name":"example.com"},{"id":"222","name":"team.example.com"}]}`)
+	})
+	var created []records.CreateOpts
+	var deleted []string
+	fakeServer.Mux.HandleFunc("/domains/111/records", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.Method {
+		case http.MethodGet:
+			_, _ = fmt.Fprint(w, `{"records":[
+				{"id":"r1","name":"example.com","type":"NS","data":"dns1.stabletransit.com","ttl":300},
+				{"id":"r2","name":"www.example.com","type":"A","data":"10.0.0.1","ttl":300},
+				{"id":"r3","name":"team.example.com","type":"NS","data":"dns1.stabletransit.com","ttl":300},
+				{"id":"r6","name":"team.example.com","type":"NS","data":"dns3.stabletransit.com","ttl":300,"comment":"`+delegationComment+`"},
+				{"id":"r7","name":"team.example.com","type":"NS","data":"ns9.elsewhere.net","ttl":300},
+				{"id":"r4","name":"old.example.com","type":"NS","data":"dns1.stabletransit.com","ttl":300,"comment":"`+delegationComment+`"},
+				{"id":"r5","name":"manual.example.com","type":"NS","data":"ns1.elsewhere.net","ttl":300}
+			]}`)
+		case http.MethodPost:
+			var payload struct {
+				Records []records.CreateOpts `json:"records"`
+			}
+			_ = json.NewDecoder(r.Body).Decode(&payload)
+			created = append(created, payload.Records...)
+			w.WriteHeader(http.StatusAccepted)
+			_, _ = fmt.Fprint(w, `{"status":"COMPLETED","response":{"records":[{"id":"r9"}]}}`)
+		case http.MethodDelete:
+			deleted = append(deleted, r.URL.Query()["id"]...)
+			w.WriteHeader(http.StatusAccepted)
+			_, _ = fmt.Fprint(w, `{"status":"COMPLETED"}`)
+		}
+	})
+	fakeServer.Mux.HandleFunc("/domains/222/records", func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, "GET")
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprint(w, `{"records":[
+			{"id":"c1","name":"team.example.com","type":"NS","data":"dns1.stabletransit.com","ttl":300},
+			{"id":"c2","name":"team.example.com","type":"NS","data":"dns2.stabletransit.com","ttl":300},
+			{"id":"c3","name":"app.team.example.com","type":"A","data":"10.0.1.1","ttl":300}
+		]}`)
+	})
+
+	p := newTestProvider(t, fakeServer.Endpoint())
+	p.config.ManageDelegations = true
+
+	endpoints, err := p.Records(context.Background())
+	if err != nil {
+		t.Fatalf("Records() error: %v", err)
+	}
+	for _, ep := range endpoints {
+		if ep.RecordType == endpoint.RecordTypeNS {
+			t.Errorf("expected NS records to stay hidden from external-dns, got %v", ep)
+		}
+	}
+
+	if len(created) != 1 {
+		t.Fatalf("expected one missing delegation record, got %+v", created)
+	}
+	if got := created[0]; got.Name != "team.example.com" || got.Type != "NS" || got.Data != "dns2.stabletransit.com" || got.Comment != delegationComment {
+		t.Errorf("unexpected delegation record: %+v", got)
+	}
+	// r4's child is gone and r6's nameserver is no longer used by the
+	// child; r7 was added by hand.
+	slices.Sort(deleted)
+	if !slices.Equal(deleted, []string{"r4", "r6"}) {
+		t.Errorf("expected only the stale managed delegations to be removed, got %v", deleted)
+	}
+
+	// Dry run reports the same changes without writing them.
+	created, deleted = nil, nil
+	p.DryRun = true
+	if _, err := p.Records(context.Background()); err != nil {
+		t.Fatalf("Records() error: %v", err)
+	}
+	if len(created) != 0 || len(deleted) != 0 {
+		t.Errorf("expected no writes in dry run, got created %+v, deleted %v", created, deleted)
+	}
+}
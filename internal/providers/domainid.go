@@ -0,0 +1,40 @@
+package providers
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/rackerlabs/goclouddns/domains"
+)
+
+// domainIDFilter is the set of Cloud DNS domain IDs the provider may manage.
+// A nil filter allows every domain that passes the name filter.
+type domainIDFilter map[string]bool
+
+func newDomainIDFilter(ids []string) domainIDFilter {
+	var filter domainIDFilter
+	for _, id := range ids {
+		if id = strings.TrimSpace(id); id != "" {
+			if filter == nil {
+				filter = domainIDFilter{}
+			}
+			filter[id] = true
+		}
+	}
+	return filter
+}
+
+// allows reports whether domainID may be read or written.
+func (f domainIDFilter) allows(domainID string) bool {
+	return f == nil || f[domainID]
+}
+
+// checkWrite refuses writes to a domain outside the filter. It is checked
+// again right before every write, independently of how the domain was
+// found, so a mistaken name filter cannot reach another zone.
+func (f domainIDFilter) checkWrite(domain *domains.DomainList) error {
+	if !f.allows(domain.ID) {
+		return fmt.Errorf("refusing to write to domain %s (%s): its ID is not in the domain ID filter", domain.Name, domain.ID)
+	}
+	return nil
+}
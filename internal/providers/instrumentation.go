@@ -0,0 +1,80 @@
+package providers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/rackerlabs/external-dns-rackspace-webhook/internal/metrics"
+)
+
+// instrumentedTransport records every Rackspace API call in metrics.APIRequests.
+// It sits on the gophercloud ProviderClient so that paginated list calls and
+// async job polling are counted as well as the calls ServiceClient makes directly.
+type instrumentedTransport struct {
+	next http.RoundTripper
+}
+
+func newInstrumentedTransport(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &instrumentedTransport{next: next}
+}
+
+func (t *instrumentedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	operation := cloudDNSOperation(req.Method, req.URL.Path)
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		metrics.APIRequests.WithLabelValues(operation, "error").Inc()
+		return resp, err
+	}
+	metrics.APIRequests.WithLabelValues(operation, strconv.Itoa(resp.StatusCode)).Inc()
+	return resp, nil
+}
+
+// cloudDNSOperation maps a request onto a low-cardinality operation name such
+// as "list_domains" or "delete_record" so IDs never end up in label values.
+func cloudDNSOperation(method, path string) string {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	for i := len(parts) - 1; i >= 0; i-- {
+		var singular, plural string
+		switch parts[i] {
+		case "tokens":
+			return "authenticate"
+		case "status":
+			return "job_status"
+		case "limits":
+			return "limits"
+		case "records":
+			singular, plural = "record", "records"
+		case "domains":
+			singular, plural = "domain", "domains"
+		case "rdns":
+			singular, plural = "rdns", "rdns"
+		default:
+			continue
+		}
+		collection := i == len(parts)-1
+		switch method {
+		case http.MethodGet:
+			if collection {
+				return "list_" + plural
+			}
+			return "get_" + singular
+		case http.MethodPost:
+			return "create_" + plural
+		case http.MethodPut:
+			if collection {
+				return "update_" + plural
+			}
+			return "update_" + singular
+		case http.MethodDelete:
+			if collection {
+				return "delete_" + plural
+			}
+			return "delete_" + singular
+		}
+	}
+	return "other"
+}
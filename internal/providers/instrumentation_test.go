@@ -0,0 +1,96 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/gophercloud/gophercloud/v2/openstack/identity/v2/tokens"
+	th "github.com/gophercloud/gophercloud/v2/testhelper"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/rackerlabs/goraxauth"
+
+	"github.com/rackerlabs/external-dns-rackspace-webhook/internal/metrics"
+)
+
+func TestCloudDNSOperation(t *testing.T) {
+	tests := []struct {
+		method string
+		path   string
+		want   string
+	}{
+		{http.MethodPost, "/v2.0/tokens", "authenticate"},
+		{http.MethodGet, "/v1.0/123456/domains", "list_domains"},
+		{http.MethodGet, "/v1.0/123456/domains/111", "get_domain"},
+		{http.MethodPost, "/v1.0/123456/domains", "create_domains"},
+		{http.MethodGet, "/v1.0/123456/domains/111/records", "list_records"},
+		{http.MethodPost, "/v1.0/123456/domains/111/records", "create_records"},
+		{http.MethodPut, "/v1.0/123456/domains/111/records/A-1", "update_record"},
+		{http.MethodDelete, "/v1.0/123456/domains/111/records/A-1", "delete_record"},
+		{http.MethodDelete, "/v1.0/123456/domains/111/records", "delete_records"},
+		{http.MethodGet, "/v1.0/123456/status/8e3b0c1a", "job_status"},
+		{http.MethodGet, "/v1.0/123456/limits", "limits"},
+		{http.MethodGet, "/", "other"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			if got := cloudDNSOperation(tt.method, tt.path); got != tt.want {
+				t.Errorf("cloudDNSOperation(%q, %q) = %q, want %q", tt.method, tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRackspaceAuthProvider_CountsAuthentication(t *testing.T) {
+	fakeServer := th.SetupHTTP()
+	defer fakeServer.Teardown()
+	fakeServer.Mux.HandleFunc("/v2.0/tokens", func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, "POST")
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprint(w, `{"access":{"token":{"id":"token-1","expires":"2099-01-01T00:00:00.000Z"},"serviceCatalog":[]}}`)
+	})
+
+	counter := metrics.APIRequests.WithLabelValues("authenticate", "200")
+	before := testutil.ToFloat64(counter)
+	opts := goraxauth.AuthOptions{AuthOptions: tokens.AuthOptions{IdentityEndpoint: fakeServer.Endpoint() + "v2.0/", Username: "user"}, ApiKey: "key"}
+	if _, err := NewRackspaceAuthProvider().Authenticate(context.Background(), opts); err != nil {
+		t.Fatalf("Authenticate() error: %v", err)
+	}
+	if got := testutil.ToFloat64(counter) - before; got != 1 {
+		t.Errorf("expected one authenticate request to be counted, got %v", got)
+	}
+}
+
+func TestInstrumentedTransport_CountsErrors(t *testing.T) {
+	fakeServer := th.SetupHTTP()
+	fakeServer.Mux.HandleFunc("/v1.0/123/domains", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	url := fakeServer.Endpoint() + "v1.0/123/domains"
+	transport := newInstrumentedTransport(nil)
+
+	unavailable := metrics.APIRequests.WithLabelValues("list_domains", "503")
+	failed := metrics.APIRequests.WithLabelValues("list_domains", "error")
+	beforeUnavailable, beforeFailed := testutil.ToFloat64(unavailable), testutil.ToFloat64(failed)
+
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("RoundTrip() error: %v", err)
+	}
+	_ = resp.Body.Close()
+	fakeServer.Teardown()
+	req, _ = http.NewRequest(http.MethodGet, url, nil)
+	if _, err := transport.RoundTrip(req); err == nil {
+		t.Fatal("expected RoundTrip() to fail once the server is gone")
+	}
+
+	if got := testutil.ToFloat64(unavailable) - beforeUnavailable; got != 1 {
+		t.Errorf("expected one 503 to be counted, got %v", got)
+	}
+	if got := testutil.ToFloat64(failed) - beforeFailed; got != 1 {
+		t.Errorf("expected one transport error to be counted, got %v", got)
+	}
+}
@@ -0,0 +1,124 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rackerlabs/goclouddns"
+)
+
+const (
+	defaultJobTimeout      = 2 * time.Minute
+	jobPollInitialInterval = 250 * time.Millisecond
+	jobPollMaxInterval     = 5 * time.Second
+
+	jobStatusCompleted = "COMPLETED"
+	jobStatusError     = "ERROR"
+)
+
+// JobError is returned when a Cloud DNS async job finishes in the ERROR state.
+type JobError struct {
+	JobID   string
+	Code    string
+	Message string
+	Details string
+}
+
+func (e *JobError) Error() string {
+	msg := fmt.Sprintf("Cloud DNS job %s failed", e.JobID)
+	if e.Code != "" {
+		msg += " (" + e.Code + ")"
+	}
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	if e.Details != "" {
+		msg += ": " + e.Details
+	}
+	return msg
+}
+
+// waitForJob polls the callback URL of an async write until the job
+// completes, fails, or jobTimeout elapses. The poll interval starts at
+// jobPollInitialInterval and doubles up to jobPollMaxInterval. On success
+// resp holds the final job body so that callers can extract the response.
+func (r *RackspaceDNSClient) waitForJob(ctx context.Context, resp *goclouddns.AsyncResult) error {
+	job, err := resp.Extract()
+	if err != nil {
+		return fmt.Errorf("failed to read async job: %w", err)
+	}
+	if job.Status == jobStatusCompleted {
+		return nil
+	}
+	if job.Status == jobStatusError {
+		return newJobError(job)
+	}
+	if job.CallbackURL == "" {
+		return fmt.Errorf("async job %s has no callback URL", job.JobID)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, r.jobTimeout)
+	defer cancel()
+
+	pollURL := job.CallbackURL + "?showDetails=true"
+	status := job.Status
+	delay := jobPollInitialInterval
+	for {
+		var latest goclouddns.AsyncResult
+		if _, latest.Err = r.client.Get(ctx, pollURL, &latest.Body, nil); latest.Err != nil {
+			if ctx.Err() != nil {
+				return jobTimeoutError(ctx, job.JobID, status)
+			}
+			return fmt.Errorf("failed to poll job %s: %w", job.JobID, latest.Err)
+		}
+		current, err := latest.Extract()
+		if err != nil {
+			return fmt.Errorf("failed to read job %s: %w", job.JobID, err)
+		}
+		status = current.Status
+		switch status {
+		case jobStatusCompleted:
+			resp.Body = latest.Body
+			return nil
+		case jobStatusError:
+			if current.JobID == "" {
+				current.JobID = job.JobID
+			}
+			return newJobError(current)
+		}
+
+		select {
+		case <-ctx.Done():
+			return jobTimeoutError(ctx, job.JobID, status)
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, jobPollMaxInterval)
+	}
+}
+
+func jobTimeoutError(ctx context.Context, jobID, status string) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("timed out waiting for Cloud DNS job %s (last status %s): %w", jobID, status, ctx.Err())
+	}
+	return fmt.Errorf("stopped waiting for Cloud DNS job %s (last status %s): %w", jobID, status, ctx.Err())
+}
+
+func newJobError(job *goclouddns.AsyncMessage) *JobError {
+	jobErr := &JobError{JobID: job.JobID}
+	if job.Error == nil {
+		jobErr.Message = "job reported ERROR without details"
+		return jobErr
+	}
+	if v, ok := job.Error["code"]; ok && v != nil {
+		jobErr.Code = fmt.Sprint(v)
+	}
+	if v, ok := job.Error["message"]; ok && v != nil {
+		jobErr.Message = fmt.Sprint(v)
+	}
+	if v, ok := job.Error["details"]; ok && v != nil {
+		jobErr.Details = fmt.Sprint(v)
+	}
+	return jobErr
+}
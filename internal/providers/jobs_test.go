@@ -0,0 +1,164 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+
+	th "github.com/gophercloud/gophercloud/v2/testhelper"
+	"github.com/rackerlabs/goclouddns/records"
+)
+
+func TestApplyChanges_SurfacesFailedJob(t *testing.T) {
+	tests := []struct {
+		name     string
+		callback string
+		wantErr  string
+	}{
+		{
+			name:     "error with details",
+			callback: `{"jobId":"job-1","status":"ERROR","error":{"code":400,"message":"Bad Request","details":"Domain already has a record with that name"}}`,
+			wantErr:  "Cloud DNS job job-1 failed (400): Bad Request: Domain already has a record with that name",
+		},
+		{
+			name:     "error without details",
+			callback: `{"jobId":"job-2","status":"ERROR"}`,
+			wantErr:  "Cloud DNS job job-2 failed: job reported ERROR without details",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakeServer := th.SetupHTTP()
+			defer fakeServer.Teardown()
+
+			fakeServer.Mux.HandleFunc("/domains", func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = fmt.Fprint(w, `{"domains":[{"id":"111","name":"example.com"}]}`)
+			})
+			fakeServer.Mux.HandleFunc("/domains/111/records", func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusAccepted)
+				_, _ = fmt.Fprint(w, `{"callbackUrl":"`+fakeServer.Endpoint()+`callback","status":"RUNNING"}`)
+			})
+			fakeServer.Mux.HandleFunc("/callback", func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = fmt.Fprint(w, tt.callback)
+			})
+
+			p := newTestProvider(t, fakeServer.Endpoint())
+			changes := &plan.Changes{
+				Create: []*endpoint.Endpoint{
+					{DNSName: "dup.example.com", RecordType: "A", Targets: []string{"10.0.0.1"}},
+				},
+			}
+			err := p.ApplyChanges(context.Background(), changes)
+			if err == nil {
+				t.Fatal("expected ApplyChanges to fail when the job errors")
+			}
+			var jobErr *JobError
+			if !errors.As(err, &jobErr) {
+				t.Errorf("expected a *JobError in %v", err)
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %q, want it to contain %q", err.Error(), tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWaitForJob_Timeout(t *testing.T) {
+	fakeServer := th.SetupHTTP()
+	defer fakeServer.Teardown()
+
+	polls := 0
+	fakeServer.Mux.HandleFunc("/domains/111/records/r1", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		_, _ = fmt.Fprint(w, `{"jobId":"job-3","callbackUrl":"`+fakeServer.Endpoint()+`callback","status":"RUNNING"}`)
+	})
+	fakeServer.Mux.HandleFunc("/callback", func(w http.ResponseWriter, r *http.Request) {
+		polls++
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprint(w, `{"jobId":"job-3","status":"RUNNING"}`)
+	})
+
+	client := NewRackspaceDNSClient(FakeDNSClient(fakeServer.Endpoint())).WithJobTimeout(600 * time.Millisecond)
+	err := client.DeleteRecord(context.Background(), "111", "r1")
+	if err == nil {
+		t.Fatal("expected DeleteRecord to time out")
+	}
+	if !errors.Is(err, context.DeadlineExceeded) || !strings.Contains(err.Error(), "job-3") {
+		t.Errorf("unexpected error: %v", err)
+	}
+	// How many polls fit in the timeout depends on scheduling, so only
+	// check that the job was polled before giving up.
+	if polls == 0 {
+		t.Error("expected the job to be polled before timing out")
+	}
+}
+
+func TestApplyChanges_IsolatesRejectedRecordInBatch(t *testing.T) {
+	fakeServer := th.SetupHTTP()
+	defer fakeServer.Teardown()
+
+	fakeServer.Mux.HandleFunc("/domains", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprint(w, `{"domains":[{"id":"111","name":"example.com"}]}`)
+	})
+	var mu sync.Mutex
+	var posts int
+	var created []string
+	fakeServer.Mux.HandleFunc("/domains/111/records", func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, "POST")
+		var payload struct {
+			Records []records.CreateOpts `json:"records"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&payload)
+		mu.Lock()
+		defer mu.Unlock()
+		posts++
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		// The job fails as a whole when any record in it is a duplicate.
+		for _, rec := range payload.Records {
+			if rec.Name == "dup.example.com" {
+				_, _ = fmt.Fprint(w, `{"jobId":"job-4","status":"ERROR","error":{"code":400,"message":"Bad Request","details":"Record is a duplicate of another record"}}`)
+				return
+			}
+		}
+		for _, rec := range payload.Records {
+			created = append(created, rec.Name)
+		}
+		_, _ = fmt.Fprint(w, `{"status":"COMPLETED","response":{"records":[]}}`)
+	})
+
+	changes := &plan.Changes{}
+	for _, name := range []string{"a", "b", "dup", "c", "d"} {
+		changes.Create = append(changes.Create, &endpoint.Endpoint{DNSName: name + ".example.com", RecordType: "A", Targets: []string{"10.0.0.1"}})
+	}
+	p := newTestProvider(t, fakeServer.Endpoint())
+	err := p.ApplyChanges(context.Background(), changes)
+	if err == nil || !strings.Contains(err.Error(), "dup.example.com") || !strings.Contains(err.Error(), "job-4") {
+		t.Fatalf("expected the duplicate record to fail on its own, got %v", err)
+	}
+	if strings.Contains(err.Error(), "a.example.com") || strings.Contains(err.Error(), "d.example.com") {
+		t.Errorf("expected only the duplicate record in the error, got %v", err)
+	}
+	if len(created) != 4 {
+		t.Errorf("expected the other four records to be created, got %v", created)
+	}
+	// 5 -> 2 + 3 -> 1 + 2 -> 1 + 1
+	if posts != 5 {
+		t.Errorf("expected the batch to be split in half until the duplicate was isolated, got %d requests", posts)
+	}
+}
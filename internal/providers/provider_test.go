@@ -6,11 +6,17 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"regexp"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/gophercloud/gophercloud/v2"
+	"github.com/gophercloud/gophercloud/v2/pagination"
+	"github.com/rackerlabs/goclouddns/domains"
+	"github.com/rackerlabs/goclouddns/records"
 	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
 
 	th "github.com/gophercloud/gophercloud/v2/testhelper"
 )
@@ -420,3 +426,619 @@ func TestRackspaceProvider_createRecord(t *testing.T) {
 		})
 	}
 }
+
+func TestApplyChanges_UpdateInPlace(t *testing.T) {
+	fakeServer := th.SetupHTTP()
+	defer fakeServer.Teardown()
+
+	fakeServer.Mux.HandleFunc("/domains", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprint(w, `{"domains":[{"id":"111","name":"example.com"}]}`)
+	})
+
+	var created, deleted []string
+	updated := map[string]string{}
+	fakeServer.Mux.HandleFunc("/domains/111/records", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.Method {
+		case http.MethodGet:
+			_, _ = fmt.Fprint(w, `{"records":[
+				{"id":"r1","name":"app.example.com","type":"A","data":"10.0.0.1","ttl":300},
+				{"id":"r2","name":"app.example.com","type":"A","data":"10.0.0.2","ttl":300},
+				{"id":"r3","name":"app.example.com","type":"A","data":"10.0.0.3","ttl":300}
+			]}`)
+		case http.MethodPost:
+			var payload struct {
+				Records []struct {
+					Data string `json:"data"`
+				} `json:"records"`
+			}
+			_ = json.NewDecoder(r.Body).Decode(&payload)
+			for _, rec := range payload.Records {
+				created = append(created, rec.Data)
+			}
+			w.WriteHeader(http.StatusAccepted)
+			_, _ = fmt.Fprint(w, `{"callbackUrl":"`+fakeServer.Endpoint()+`callback","status":"RUNNING"}`)
+		case http.MethodDelete:
+			deleted = append(deleted, r.URL.Query()["id"]...)
+			w.WriteHeader(http.StatusAccepted)
+			_, _ = fmt.Fprint(w, `{"callbackUrl":"`+fakeServer.Endpoint()+`callback","status":"RUNNING"}`)
+		}
+	})
+	fakeServer.Mux.HandleFunc("/domains/111/records/", func(w http.ResponseWriter, r *http.Request) {
+		id := r.URL.Path[len("/domains/111/records/"):]
+		switch r.Method {
+		case http.MethodPut:
+			var payload struct {
+				Data string `json:"data"`
+			}
+			_ = json.NewDecoder(r.Body).Decode(&payload)
+			updated[id] = payload.Data
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		_, _ = fmt.Fprint(w, `{"callbackUrl":"`+fakeServer.Endpoint()+`callback","status":"RUNNING"}`)
+	})
+	fakeServer.Mux.HandleFunc("/callback", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprint(w, `{"status":"COMPLETED","response":{"records":[{"id":"r9"}]}}`)
+	})
+
+	p := newTestProvider(t, fakeServer.Endpoint())
+	changes := &plan.Changes{
+		UpdateOld: []*endpoint.Endpoint{
+			{DNSName: "app.example.com", RecordType: "A", Targets: []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"}},
+		},
+		UpdateNew: []*endpoint.Endpoint{
+			{DNSName: "app.example.com", RecordType: "A", Targets: []string{"10.0.0.1", "10.0.0.4"}},
+		},
+	}
+	if err := p.ApplyChanges(context.Background(), changes); err != nil {
+		t.Fatalf("ApplyChanges() error: %v", err)
+	}
+
+	if len(created) != 0 {
+		t.Errorf("expected no creates, got %v", created)
+	}
+	if len(updated) != 1 || updated["r2"] != "10.0.0.4" {
+		t.Errorf("expected r2 rewritten to 10.0.0.4, got %v", updated)
+	}
+	if len(deleted) != 1 || deleted[0] != "r3" {
+		t.Errorf("expected only r3 deleted, got %v", deleted)
+	}
+}
+
+func TestRackspaceProvider_Readiness(t *testing.T) {
+	tests := []struct {
+		name      string
+		provider  *RackspaceProvider
+		wantReady bool
+		wantFail  string
+	}{
+		{
+			name:      "healthy",
+			provider:  &RackspaceProvider{tokenExpiry: time.Now().Add(time.Hour)},
+			wantReady: true,
+		},
+		{
+			name:     "last authentication failed",
+			provider: &RackspaceProvider{tokenExpiry: time.Now().Add(time.Hour), lastAuthErr: fmt.Errorf("401 Unauthorized")},
+			wantFail: "authentication",
+		},
+		{
+			name:     "token expired",
+			provider: &RackspaceProvider{tokenExpiry: time.Now().Add(-time.Minute)},
+			wantFail: "token",
+		},
+		{
+			name:      "single sync failed",
+			provider:  &RackspaceProvider{tokenExpiry: time.Now().Add(time.Hour), lastListErr: fmt.Errorf("503 Service Unavailable"), failedSyncs: 1},
+			wantReady: true,
+		},
+		{
+			name:     "syncs keep failing",
+			provider: &RackspaceProvider{tokenExpiry: time.Now().Add(time.Hour), lastListErr: fmt.Errorf("503 Service Unavailable"), failedSyncs: syncFailureThreshold},
+			wantFail: "cloudDNS",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.provider.Readiness()
+			if got.Ready != tt.wantReady {
+				t.Errorf("Readiness().Ready = %v, want %v (checks %+v)", got.Ready, tt.wantReady, got.Checks)
+			}
+			for name, check := range got.Checks {
+				if wantOK := name != tt.wantFail; check.OK != wantOK {
+					t.Errorf("check %s OK = %v, want %v", name, check.OK, wantOK)
+				}
+			}
+		})
+	}
+}
+
+func TestRecords_ReadinessCountsFailedSyncs(t *testing.T) {
+	fakeServer := th.SetupHTTP()
+	defer fakeServer.Teardown()
+
+	fakeServer.Mux.HandleFunc("/domains", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprint(w, `{"domains":[{"id":"111","name":"example.com"},{"id":"222","name":"dev.example.com"}]}`)
+	})
+	fakeServer.Mux.HandleFunc("/domains/111/records", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprint(w, `{"records":[]}`)
+	})
+	// One zone fails on every sync while its sibling lists fine.
+	failing := true
+	fakeServer.Mux.HandleFunc("/domains/222/records", func(w http.ResponseWriter, r *http.Request) {
+		if failing {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprint(w, `{"records":[]}`)
+	})
+
+	p := newTestProvider(t, fakeServer.Endpoint())
+	p.tokenExpiry = time.Now().Add(time.Hour)
+	for i := 1; i <= syncFailureThreshold; i++ {
+		if _, err := p.Records(context.Background()); err == nil {
+			t.Fatal("expected Records() to fail")
+		}
+		if ready := p.Readiness().Ready; ready != (i < syncFailureThreshold) {
+			t.Errorf("after %d failed syncs Ready = %v", i, ready)
+		}
+	}
+
+	failing = false
+	if _, err := p.Records(context.Background()); err != nil {
+		t.Fatalf("Records() error: %v", err)
+	}
+	if got := p.Readiness(); !got.Ready || got.Checks["cloudDNS"].Error != "" {
+		t.Errorf("expected a successful sync to clear the failure, got %+v", got.Checks)
+	}
+}
+
+func TestApplyChanges_ReusesCacheFilledByRecords(t *testing.T) {
+	fakeServer := th.SetupHTTP()
+	defer fakeServer.Teardown()
+
+	domainLists, recordLists := 0, 0
+	fakeServer.Mux.HandleFunc("/domains", func(w http.ResponseWriter, r *http.Request) {
+		domainLists++
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprint(w, `{"domains":[{"id":"111","name":"example.com"},{"id":"222","name":"other.com"}]}`)
+	})
+	fakeServer.Mux.HandleFunc("/domains/111/records", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == http.MethodGet {
+			recordLists++
+			_, _ = fmt.Fprint(w, `{"records":[
+				{"id":"r1","name":"old.example.com","type":"A","data":"10.0.0.1","ttl":300},
+				{"id":"r2","name":"gone.example.com","type":"A","data":"10.0.0.2","ttl":300}
+			]}`)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+		_, _ = fmt.Fprint(w, `{"callbackUrl":"`+fakeServer.Endpoint()+`callback","status":"RUNNING"}`)
+	})
+	fakeServer.Mux.HandleFunc("/domains/111/records/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		_, _ = fmt.Fprint(w, `{"callbackUrl":"`+fakeServer.Endpoint()+`callback","status":"RUNNING"}`)
+	})
+	fakeServer.Mux.HandleFunc("/callback", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprint(w, `{"status":"COMPLETED","response":{"records":[{"id":"r9"}]}}`)
+	})
+
+	p := newTestProvider(t, fakeServer.Endpoint())
+	p.cache = newZoneCache(time.Minute)
+
+	if _, err := p.Records(context.Background()); err != nil {
+		t.Fatalf("Records() error: %v", err)
+	}
+	changes := &plan.Changes{
+		Create: []*endpoint.Endpoint{
+			{DNSName: "new1.example.com", RecordType: "A", Targets: []string{"10.0.0.3"}},
+			{DNSName: "new2.example.com", RecordType: "A", Targets: []string{"10.0.0.4"}},
+		},
+		Delete: []*endpoint.Endpoint{
+			{DNSName: "gone.example.com", RecordType: "A", Targets: []string{"10.0.0.2"}},
+		},
+	}
+	if err := p.ApplyChanges(context.Background(), changes); err != nil {
+		t.Fatalf("ApplyChanges() error: %v", err)
+	}
+
+	if domainLists != 1 {
+		t.Errorf("expected the domain list to be fetched once, got %d", domainLists)
+	}
+	if recordLists != 1 {
+		t.Errorf("expected zone records to be fetched once by Records, got %d", recordLists)
+	}
+
+	// Writes invalidate the zone, so the next lookup reads it back
+	if _, ok := p.cache.getRecords("111"); ok {
+		t.Errorf("expected zone 111 to be invalidated after writes")
+	}
+}
+
+func TestApplyChanges_UpdatesShareZoneListing(t *testing.T) {
+	fakeServer := th.SetupHTTP()
+	defer fakeServer.Teardown()
+
+	fakeServer.Mux.HandleFunc("/domains", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprint(w, `{"domains":[{"id":"111","name":"example.com"}]}`)
+	})
+	recordLists := 0
+	fakeServer.Mux.HandleFunc("/domains/111/records", func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, "GET")
+		recordLists++
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprint(w, `{"records":[
+			{"id":"r1","name":"a.example.com","type":"A","data":"10.0.0.1","ttl":300},
+			{"id":"r2","name":"b.example.com","type":"A","data":"10.0.0.2","ttl":300},
+			{"id":"r3","name":"c.example.com","type":"A","data":"10.0.0.3","ttl":300}
+		]}`)
+	})
+	puts := 0
+	fakeServer.Mux.HandleFunc("/domains/111/records/", func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, "PUT")
+		puts++
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		_, _ = fmt.Fprint(w, `{"status":"COMPLETED"}`)
+	})
+
+	p := newTestProvider(t, fakeServer.Endpoint())
+	p.cache = newZoneCache(time.Minute)
+	if _, err := p.Records(context.Background()); err != nil {
+		t.Fatalf("Records() error: %v", err)
+	}
+
+	changes := &plan.Changes{}
+	for i, name := range []string{"a.example.com", "b.example.com", "c.example.com"} {
+		target := fmt.Sprintf("10.0.0.%d", i+1)
+		changes.UpdateOld = append(changes.UpdateOld, endpoint.NewEndpointWithTTL(name, endpoint.RecordTypeA, 300, target))
+		changes.UpdateNew = append(changes.UpdateNew, endpoint.NewEndpointWithTTL(name, endpoint.RecordTypeA, 600, target))
+	}
+	if err := p.ApplyChanges(context.Background(), changes); err != nil {
+		t.Fatalf("ApplyChanges() error: %v", err)
+	}
+
+	if puts != 3 {
+		t.Errorf("expected 3 updates, got %d", puts)
+	}
+	if recordLists != 1 {
+		t.Errorf("expected the zone to be listed only by Records, got %d listings", recordLists)
+	}
+	if _, ok := p.cache.getRecords("111"); ok {
+		t.Errorf("expected zone 111 to be invalidated once the changes are applied")
+	}
+}
+
+func TestApplyChanges_BulkCreatePerZone(t *testing.T) {
+	fakeServer := th.SetupHTTP()
+	defer fakeServer.Teardown()
+
+	fakeServer.Mux.HandleFunc("/domains", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprint(w, `{"domains":[{"id":"111","name":"example.com"},{"id":"222","name":"other.com"}]}`)
+	})
+	posts := map[string][]int{}
+	for _, id := range []string{"111", "222"} {
+		fakeServer.Mux.HandleFunc("/domains/"+id+"/records", func(w http.ResponseWriter, r *http.Request) {
+			th.TestMethod(t, r, "POST")
+			var payload struct {
+				Records []json.RawMessage `json:"records"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+				t.Fatalf("failed to parse request body: %v", err)
+			}
+			posts[id] = append(posts[id], len(payload.Records))
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusAccepted)
+			_, _ = fmt.Fprint(w, `{"callbackUrl":"`+fakeServer.Endpoint()+`callback","status":"RUNNING"}`)
+		})
+	}
+	fakeServer.Mux.HandleFunc("/callback", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprint(w, `{"status":"COMPLETED","response":{"records":[]}}`)
+	})
+
+	changes := &plan.Changes{}
+	for i := 0; i < 150; i++ {
+		changes.Create = append(changes.Create, &endpoint.Endpoint{
+			DNSName: fmt.Sprintf("host%d.example.com", i), RecordType: "A", Targets: []string{"10.0.0.1"},
+		})
+	}
+	changes.Create = append(changes.Create,
+		&endpoint.Endpoint{DNSName: "a.other.com", RecordType: "A", Targets: []string{"10.0.1.1", "10.0.1.2"}},
+		&endpoint.Endpoint{DNSName: "b.other.com", RecordType: "CNAME", Targets: []string{"a.other.com"}},
+	)
+
+	p := newTestProvider(t, fakeServer.Endpoint())
+	p.DomainFilter = endpoint.NewDomainFilter([]string{"example.com", "other.com"})
+	if err := p.ApplyChanges(context.Background(), changes); err != nil {
+		t.Fatalf("ApplyChanges() error: %v", err)
+	}
+
+	if got := posts["111"]; len(got) != 2 || got[0] != maxRecordsPerRequest || got[1] != 50 {
+		t.Errorf("expected example.com batches [%d 50], got %v", maxRecordsPerRequest, got)
+	}
+	if got := posts["222"]; len(got) != 1 || got[0] != 3 {
+		t.Errorf("expected one other.com batch of 3, got %v", got)
+	}
+}
+
+func TestApplyChanges_BulkDeletePerZone(t *testing.T) {
+	fakeServer := th.SetupHTTP()
+	defer fakeServer.Teardown()
+
+	fakeServer.Mux.HandleFunc("/domains", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprint(w, `{"domains":[{"id":"111","name":"example.com"}]}`)
+	})
+	var deleteCalls [][]string
+	fakeServer.Mux.HandleFunc("/domains/111/records", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.Method {
+		case http.MethodGet:
+			_, _ = fmt.Fprint(w, `{"records":[
+				{"id":"r1","name":"a.example.com","type":"A","data":"10.0.0.1","ttl":300},
+				{"id":"r2","name":"a.example.com","type":"A","data":"10.0.0.2","ttl":300},
+				{"id":"r3","name":"b.example.com","type":"CNAME","data":"a.example.com","ttl":300},
+				{"id":"r4","name":"keep.example.com","type":"A","data":"10.0.0.4","ttl":300}
+			]}`)
+		case http.MethodDelete:
+			deleteCalls = append(deleteCalls, r.URL.Query()["id"])
+			w.WriteHeader(http.StatusAccepted)
+			_, _ = fmt.Fprint(w, `{"callbackUrl":"`+fakeServer.Endpoint()+`callback","status":"RUNNING"}`)
+		default:
+			t.Errorf("unexpected %s on records collection", r.Method)
+		}
+	})
+	fakeServer.Mux.HandleFunc("/domains/111/records/", func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected per-record %s %s", r.Method, r.URL.Path)
+	})
+	fakeServer.Mux.HandleFunc("/callback", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprint(w, `{"status":"COMPLETED"}`)
+	})
+
+	p := newTestProvider(t, fakeServer.Endpoint())
+	changes := &plan.Changes{
+		Delete: []*endpoint.Endpoint{
+			{DNSName: "a.example.com", RecordType: "A", Targets: []string{"10.0.0.1", "10.0.0.2"}},
+			{DNSName: "b.example.com", RecordType: "CNAME", Targets: []string{"a.example.com"}},
+		},
+	}
+	if err := p.ApplyChanges(context.Background(), changes); err != nil {
+		t.Fatalf("ApplyChanges() error: %v", err)
+	}
+
+	if len(deleteCalls) != 1 {
+		t.Fatalf("expected one bulk delete call, got %d: %v", len(deleteCalls), deleteCalls)
+	}
+	if got := strings.Join(deleteCalls[0], ","); got != "r1,r2,r3" {
+		t.Errorf("deleted ids = %s, want r1,r2,r3", got)
+	}
+}
+
+func TestDomainFilter_ExcludedSubZones(t *testing.T) {
+	fakeServer := th.SetupHTTP()
+	defer fakeServer.Teardown()
+
+	fakeServer.Mux.HandleFunc("/domains", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprint(w, `{"domains":[{"id":"111","name":"example.com"},{"id":"222","name":"corp.example.com"}]}`)
+	})
+	var created []string
+	fakeServer.Mux.HandleFunc("/domains/111/records", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == http.MethodPost {
+			created = append(created, r.URL.Path)
+			w.WriteHeader(http.StatusAccepted)
+			_, _ = fmt.Fprint(w, `{"status":"COMPLETED","response":{"records":[{"id":"r9"}]}}`)
+			return
+		}
+		_, _ = fmt.Fprint(w, `{"records":[
+			{"id":"r1","name":"www.example.com","type":"A","data":"10.0.0.1","ttl":300},
+			{"id":"r2","name":"vpn.corp.example.com","type":"A","data":"10.0.0.2","ttl":300}
+		]}`)
+	})
+	fakeServer.Mux.HandleFunc("/domains/222/records", func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("excluded zone corp.example.com was accessed: %s %s", r.Method, r.URL.Path)
+	})
+
+	tests := []struct {
+		name   string
+		config *RackspaceConfig
+	}{
+		{
+			name:   "exclusion list",
+			config: &RackspaceConfig{DomainFilter: []string{"example.com"}, DomainFilterExclude: []string{"corp.example.com"}},
+		},
+		{
+			name:   "regex exclusion",
+			config: &RackspaceConfig{RegexDomainFilter: regexp.MustCompile(`example\.com$`), RegexDomainExclusion: regexp.MustCompile(`(^|\.)corp\.example\.com$`)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			created = nil
+			p := newTestProvider(t, fakeServer.Endpoint())
+			p.DomainFilter = newDomainFilter(tt.config)
+
+			endpoints, err := p.Records(context.Background())
+			if err != nil {
+				t.Fatalf("Records() error: %v", err)
+			}
+			if len(endpoints) != 1 || endpoints[0].DNSName != "www.example.com" {
+				t.Errorf("expected only www.example.com, got %v", endpoints)
+			}
+
+			changes := &plan.Changes{Create: []*endpoint.Endpoint{
+				{DNSName: "api.example.com", RecordType: "A", Targets: []string{"10.0.0.3"}},
+				{DNSName: "app.corp.example.com", RecordType: "A", Targets: []string{"10.0.0.4"}},
+			}}
+			err = p.ApplyChanges(context.Background(), changes)
+			if err == nil || !strings.Contains(err.Error(), "app.corp.example.com is excluded by the domain filter") {
+				t.Errorf("expected the excluded name to be refused, got %v", err)
+			}
+			if len(created) != 1 {
+				t.Errorf("expected api.example.com to be created in example.com, got %v", created)
+			}
+		})
+	}
+}
+
+func TestDomainIDFilter(t *testing.T) {
+	fakeServer := th.SetupHTTP()
+	defer fakeServer.Teardown()
+
+	fakeServer.Mux.HandleFunc("/domains", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprint(w, `{"domains":[{"id":"111","name":"example.com"},{"id":"222","name":"team.example.com"}]}`)
+	})
+	fakeServer.Mux.HandleFunc("/domains/111/records", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprint(w, `{"records":[{"id":"r1","name":"www.example.com","type":"A","data":"10.0.0.1","ttl":300}]}`)
+	})
+	fakeServer.Mux.HandleFunc("/domains/222/", func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("domain 222 outside the ID filter was accessed: %s %s", r.Method, r.URL.Path)
+	})
+
+	p := newTestProvider(t, fakeServer.Endpoint())
+	p.domainIDs = newDomainIDFilter([]string{" 111 "})
+
+	endpoints, err := p.Records(context.Background())
+	if err != nil {
+		t.Fatalf("Records() error: %v", err)
+	}
+	if len(endpoints) != 1 || endpoints[0].DNSName != "www.example.com" {
+		t.Errorf("expected only records from domain 111, got %v", endpoints)
+	}
+
+	// The longest match is outside the filter; the parent zone must not be used instead.
+	if _, err := p.findDomain(context.Background(), "app.team.example.com"); err == nil || !strings.Contains(err.Error(), "not in the domain ID filter") {
+		t.Errorf("expected findDomain() to refuse domain 222, got %v", err)
+	}
+
+	// Writes are refused even when handed a domain directly.
+	other := &domains.DomainList{ID: "222", Name: "team.example.com"}
+	if err := p.createInDomain(context.Background(), other, []records.CreateOpts{{Name: "app.team.example.com", Type: "A", Data: "10.0.0.2"}}); err == nil {
+		t.Error("expected createInDomain() to refuse domain 222")
+	}
+	if err := p.deleteInDomain(context.Background(), other, []records.RecordList{{ID: "r2", Name: "app.team.example.com"}}); err == nil {
+		t.Error("expected deleteInDomain() to refuse domain 222")
+	}
+}
+
+func TestUpdateRecord_KeepsForeignComments(t *testing.T) {
+	tests := []struct {
+		name        string
+		comment     string
+		ttl         int64
+		wantPut     bool
+		wantComment string
+	}{
+		{name: "unchanged record with a hand-written comment", comment: "owned by the mail team", ttl: 300},
+		{name: "TTL change keeps a hand-written comment", comment: "owned by the mail team", ttl: 600, wantPut: true, wantComment: "owned by the mail team"},
+		{name: "dropped device href clears its comment", comment: rdnsCommentPrefix + "https://servers/abc", ttl: 300, wantPut: true, wantComment: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakeServer := th.SetupHTTP()
+			defer fakeServer.Teardown()
+
+			fakeServer.Mux.HandleFunc("/domains", func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = fmt.Fprint(w, `{"domains":[{"id":"111","name":"example.com"}]}`)
+			})
+			fakeServer.Mux.HandleFunc("/domains/111/records", func(w http.ResponseWriter, r *http.Request) {
+				th.TestMethod(t, r, "GET")
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = fmt.Fprintf(w, `{"records":[{"id":"r1","name":"mail.example.com","type":"A","data":"10.0.0.1","ttl":300,"comment":%q}]}`, tt.comment)
+			})
+			var puts int
+			var gotComment *string
+			fakeServer.Mux.HandleFunc("/domains/111/records/r1", func(w http.ResponseWriter, r *http.Request) {
+				th.TestMethod(t, r, "PUT")
+				puts++
+				var payload struct {
+					Comment *string `json:"comment"`
+				}
+				_ = json.NewDecoder(r.Body).Decode(&payload)
+				gotComment = payload.Comment
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusAccepted)
+				_, _ = fmt.Fprint(w, `{"status":"COMPLETED"}`)
+			})
+
+			p := newTestProvider(t, fakeServer.Endpoint())
+			ep := endpoint.NewEndpointWithTTL("mail.example.com", endpoint.RecordTypeA, endpoint.TTL(tt.ttl), "10.0.0.1")
+			if err := p.updateRecord(context.Background(), nil, ep); err != nil {
+				t.Fatalf("updateRecord() error: %v", err)
+			}
+			if (puts > 0) != tt.wantPut {
+				t.Fatalf("expected update request %v, got %d", tt.wantPut, puts)
+			}
+			if tt.wantPut && (gotComment == nil || *gotComment != tt.wantComment) {
+				t.Errorf("expected comment %q in update request, got %v", tt.wantComment, gotComment)
+			}
+		})
+	}
+}
+
+// otherPage is a page type the goclouddns extractors do not expect.
+type otherPage struct {
+	pagination.SinglePageBase
+}
+
+func (otherPage) IsEmpty() (bool, error) { return false, nil }
+
+// singlePageClient lists domains and records as otherPage.
+type singlePageClient struct {
+	ServiceClient
+	client *gophercloud.ServiceClient
+}
+
+func (c singlePageClient) pager(url string) pagination.Pager {
+	return pagination.NewPager(c.client, url, func(r pagination.PageResult) pagination.Page {
+		return otherPage{pagination.SinglePageBase(r)}
+	})
+}
+
+func (c singlePageClient) ListDomains(ctx context.Context, opts domains.ListOpts) pagination.Pager {
+	return c.pager(c.client.ServiceURL("domains"))
+}
+
+func (c singlePageClient) ListRecords(ctx context.Context, domainID string, opts records.ListOpts) pagination.Pager {
+	return c.pager(c.client.ServiceURL("domains", domainID, "records"))
+}
+
+func TestFetch_UnexpectedPageType(t *testing.T) {
+	fakeServer := th.SetupHTTP()
+	defer fakeServer.Teardown()
+	fakeServer.Mux.HandleFunc("/domains", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprint(w, `{"domains":[{"id":"111","name":"example.com"}]}`)
+	})
+	fakeServer.Mux.HandleFunc("/domains/111/records", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprint(w, `{"records":[]}`)
+	})
+
+	p := newTestProvider(t, fakeServer.Endpoint())
+	p.serviceClient = singlePageClient{client: FakeDNSClient(fakeServer.Endpoint())}
+	if _, err := p.fetchDomains(context.Background()); err == nil || !strings.Contains(err.Error(), "unexpected page type") {
+		t.Errorf("expected fetchDomains to reject the page, got %v", err)
+	}
+	if _, err := p.fetchZoneRecords(context.Background(), "111"); err == nil || !strings.Contains(err.Error(), "unexpected page type") {
+		t.Errorf("expected fetchZoneRecords to reject the page, got %v", err)
+	}
+}
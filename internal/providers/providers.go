@@ -5,19 +5,27 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net/http"
+	"regexp"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/charmbracelet/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 
 	"github.com/gophercloud/gophercloud/v2"
 	"github.com/gophercloud/gophercloud/v2/openstack/identity/v2/tokens"
-	"github.com/gophercloud/gophercloud/v2/pagination"
 	"github.com/rackerlabs/goclouddns/domains"
 	"github.com/rackerlabs/goclouddns/records"
 	"github.com/rackerlabs/goraxauth"
+
+	"github.com/rackerlabs/external-dns-rackspace-webhook/internal/logging"
+	"github.com/rackerlabs/external-dns-rackspace-webhook/internal/metrics"
+	"github.com/rackerlabs/external-dns-rackspace-webhook/internal/tracing"
 	"sigs.k8s.io/external-dns/endpoint"
 	"sigs.k8s.io/external-dns/plan"
 )
@@ -25,17 +33,75 @@ import (
 const (
 	defaultTokenLifetime   = 4 * time.Hour
 	tokenRefreshBeforeTime = -1 * time.Hour
+	// authTimeout bounds a single authentication against Rackspace Identity.
+	authTimeout = 120 * time.Second
+	// maxRecordsPerRequest is the most records Cloud DNS accepts in a
+	// single create or delete call.
+	maxRecordsPerRequest = 100
 )
 
 type RackspaceConfig struct {
+	// AccountName labels this credential set in logs, metrics and readiness
+	// when several accounts are configured.
+	AccountName      string
 	IdentityEndpoint string
 	Username         string
 	APIKey           string
-	TenantID         string
-	Listen           string
-	DomainFilter     []string
+	// UsernameFile and APIKeyFile name mounted Secret files that supply
+	// Username and APIKey. WatchCredentials reloads them when they change.
+	UsernameFile string
+	APIKeyFile   string
+	TenantID     string
+	// Region and Availability select the Cloud DNS entry in the service
+	// catalog. Empty values take the first entry and its public URL.
+	Region       string
+	Availability gophercloud.Availability
+	// DNSEndpoint, when set, is used as the Cloud DNS base URL instead of
+	// the service catalog.
+	DNSEndpoint  string
+	Listen       string
+	DomainFilter []string
+	// DomainFilterExclude removes sub-zones and names from DomainFilter.
+	DomainFilterExclude []string
+	// RegexDomainFilter and RegexDomainExclusion replace DomainFilter and
+	// DomainFilterExclude when either is set, as in external-dns.
+	RegexDomainFilter    *regexp.Regexp
+	RegexDomainExclusion *regexp.Regexp
+	// DomainIDFilter, when set, limits management to these Cloud DNS
+	// domain IDs, whatever their names.
+	DomainIDFilter []string
+	// ZoneCreation creates missing domains for new records.
+	ZoneCreation ZoneCreation
+	// ManageDelegations keeps NS records in managed parent domains in step
+	// with their managed child domains.
+	ManageDelegations bool
+	// ManagePTRRecords adds PTR records for A and AAAA endpoints to the
+	// managed in-addr.arpa and ip6.arpa domains.
+	ManagePTRRecords bool
 	DryRun           bool
 	LogLevel         string
+	LogFormat        string
+	// TracingEnabled exports OpenTelemetry spans over OTLP.
+	TracingEnabled bool
+	// CacheTTL bounds how long domain and record listings are reused
+	// between Records and ApplyChanges. Zero disables the cache.
+	CacheTTL time.Duration
+	// JobTimeout bounds how long a write waits for its Cloud DNS async job.
+	JobTimeout time.Duration
+	// RetryMaxAttempts caps how many times a throttled or unavailable
+	// Cloud DNS call is attempted before giving up.
+	RetryMaxAttempts int
+	// RateLimits caps Cloud DNS requests per minute for each operation class.
+	RateLimits RateLimits
+	// RateLimitsFromAccount tightens RateLimits to the account's /limits at startup.
+	RateLimitsFromAccount bool
+	// TTL clamps and defaults endpoint TTLs in AdjustEndpoints.
+	TTL TTLPolicy
+	// TTLOverrides replaces parts of TTL for a domain and its subdomains.
+	TTLOverrides map[string]TTLPolicy
+	// Accounts, when set, replaces the single set of credentials above with
+	// one Rackspace account per group of domains.
+	Accounts []AccountConfig
 }
 
 type RackspaceProvider struct {
@@ -43,53 +109,88 @@ type RackspaceProvider struct {
 	serviceClient ServiceClient
 	authProvider  AuthProvider
 	tokenExpiry   time.Time
+	refresh       tokenRefresh
+	lastAuthErr   error
+	lastListErr   error
+	failedSyncs   int
+	cache         *zoneCache
+	retry         *retryPolicy
+	limiter       *rateLimiter
 	config        *RackspaceConfig
+	domainIDs     domainIDFilter
+	createdZones  []string
 	DomainFilter  *endpoint.DomainFilter
 	DryRun        bool
 }
 
 func NewRackspaceProvider(config *RackspaceConfig) (*RackspaceProvider, error) {
-	authProvider := NewRackspaceAuthProvider()
-	ctx, cancel := context.WithTimeout(context.Background(), 120*time.Second)
+	p := &RackspaceProvider{
+		authProvider: NewRackspaceAuthProvider(),
+		cache:        newZoneCache(config.CacheTTL),
+		retry:        newRetryPolicy(config.RetryMaxAttempts),
+		config:       config,
+		domainIDs:    newDomainIDFilter(config.DomainIDFilter),
+		DomainFilter: newDomainFilter(config),
+		DryRun:       config.DryRun,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), authTimeout)
 	defer cancel()
-	client, tokenExpiry, err := authenticateAndCreateClient(ctx, authProvider, config)
+	client, tokenExpiry, err := authenticateAndCreateClient(ctx, p.authProvider, config, p.recordReauth)
 	if err != nil {
 		return nil, err
 	}
+	p.tokenExpiry = tokenExpiry
+	p.refresh.last = time.Now()
 
-	dnsClient := NewRackspaceDNSClient(client)
-	domainFilter := endpoint.NewDomainFilter(config.DomainFilter)
+	rateLimits := config.RateLimits
+	if config.RateLimitsFromAccount {
+		rateLimits = loadAccountRateLimits(ctx, NewRackspaceDNSClient(client), rateLimits)
+	}
+	p.limiter = newRateLimiter(rateLimits)
+	p.serviceClient = p.newServiceClient(client)
 
-	log.Info("Initialized provider", "domainFilter", config.DomainFilter, "dryRun", config.DryRun)
+	log.Info("Initialized provider", "account", p.accountName(), "domainFilter", config.DomainFilter, "domainIDFilter", config.DomainIDFilter, "dryRun", config.DryRun, "cacheTTL", config.CacheTTL)
 
-	return &RackspaceProvider{
-		serviceClient: dnsClient,
-		authProvider:  authProvider,
-		tokenExpiry:   tokenExpiry,
-		config:        config,
-		DomainFilter:  domainFilter,
-		DryRun:        config.DryRun,
-	}, nil
+	return p, nil
 }
 
-func (p *RackspaceProvider) getClient(ctx context.Context) ServiceClient {
-	p.mu.Lock()
-	defer p.mu.Unlock()
-	if time.Now().Before(p.tokenExpiry.Add(tokenRefreshBeforeTime)) {
-		return p.serviceClient
-	}
-	clientRaw, tokenExpiry, err := authenticateAndCreateClient(ctx, p.authProvider, p.config)
-	if err != nil {
-		log.Error("Failed to refresh Rackspace token", "error", err)
-		return p.serviceClient
+// newDomainFilter builds the filter applied to zones and record names. A
+// regex filter takes precedence over the domain lists.
+func newDomainFilter(config *RackspaceConfig) *endpoint.DomainFilter {
+	return endpoint.NewDomainFilterWithOptions(
+		endpoint.WithDomainFilter(config.DomainFilter),
+		endpoint.WithDomainExclude(config.DomainFilterExclude),
+		endpoint.WithRegexDomainFilter(config.RegexDomainFilter),
+		endpoint.WithRegexDomainExclude(config.RegexDomainExclusion),
+	)
+}
+
+// GetDomainFilter returns the filter negotiated with external-dns.
+func (p *RackspaceProvider) GetDomainFilter() endpoint.DomainFilterInterface {
+	return p.negotiatedDomainFilter()
+}
+
+// accountName labels this provider's account in metrics and logs.
+func (p *RackspaceProvider) accountName() string {
+	if p.config == nil || p.config.AccountName == "" {
+		return defaultAccountName
 	}
-	p.serviceClient = NewRackspaceDNSClient(clientRaw)
-	p.tokenExpiry = tokenExpiry
-	log.Info("Refreshed Rackspace token", "expiresAt", tokenExpiry)
-	return p.serviceClient
+	return p.config.AccountName
+}
+
+// newServiceClient builds the ServiceClient used for all Cloud DNS calls.
+// Retries sit outside the rate limiter so every attempt waits for a token,
+// and both are shared across token refreshes. Tracing wraps everything so a
+// span covers the whole call.
+func (p *RackspaceProvider) newServiceClient(client *gophercloud.ServiceClient) ServiceClient {
+	dnsClient := NewRackspaceDNSClient(client).WithJobTimeout(p.config.JobTimeout)
+	return newTracingServiceClient(newRetryingServiceClient(newRateLimitedServiceClient(dnsClient, p.limiter), p.retry))
 }
 
-func authenticateAndCreateClient(ctx context.Context, authProvider AuthProvider, config *RackspaceConfig) (*gophercloud.ServiceClient, time.Time, error) {
+// authenticateAndCreateClient authenticates and builds the Cloud DNS client.
+// onReauth, when set, is told the outcome of every re-authentication the
+// client makes on its own after a 401.
+func authenticateAndCreateClient(ctx context.Context, authProvider AuthProvider, config *RackspaceConfig, onReauth func(time.Time, error)) (*gophercloud.ServiceClient, time.Time, error) {
 	authOpts := goraxauth.AuthOptions{
 		AuthOptions: tokens.AuthOptions{
 			IdentityEndpoint: config.IdentityEndpoint,
@@ -105,136 +206,229 @@ func authenticateAndCreateClient(ctx context.Context, authProvider AuthProvider,
 	if err != nil {
 		return nil, time.Time{}, fmt.Errorf("failed to authenticate with Rackspace: %v", err)
 	}
+	// RackspaceAuthProvider instruments the client before authenticating;
+	// other AuthProviders get it here, for the Cloud DNS calls.
+	if _, ok := provider.HTTPClient.Transport.(*instrumentedTransport); !ok {
+		provider.HTTPClient.Transport = newInstrumentedTransport(provider.HTTPClient.Transport)
+	}
+	// Rackspace can revoke a token well before tokenExpiry. On a 401,
+	// gophercloud calls ReauthFunc once and replays the request with the
+	// new token; concurrent callers share a single re-authentication.
+	provider.UseTokenLock()
+	provider.ReauthFunc = func(ctx context.Context) error {
+		fresh, err := authProvider.Authenticate(ctx, authOpts)
+		if err != nil {
+			metrics.TokenRefreshes.WithLabelValues("failure").Inc()
+			err = fmt.Errorf("failed to re-authenticate with Rackspace: %v", err)
+			if onReauth != nil {
+				onReauth(time.Time{}, err)
+			}
+			return err
+		}
+		provider.CopyTokenFrom(fresh)
+		metrics.TokenRefreshes.WithLabelValues("success").Inc()
+		tokenExpiry := tokenExpiryFrom(ctx, fresh)
+		logging.FromContext(ctx).Info("Re-authenticated after Cloud DNS rejected the token", "expiresAt", tokenExpiry)
+		if onReauth != nil {
+			onReauth(tokenExpiry, nil)
+		}
+		return nil
+	}
+
+	client, err := createDNSClient(authProvider, provider, config)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("failed to create Cloud DNS client: %v", err)
+	}
 
+	return client, tokenExpiryFrom(ctx, provider), nil
+}
+
+// tokenExpiryFrom returns when the token held by provider expires, falling
+// back to defaultTokenLifetime from now when Identity did not say.
+func tokenExpiryFrom(ctx context.Context, provider *gophercloud.ProviderClient) time.Time {
 	tokenExpiry := time.Now().Add(defaultTokenLifetime)
 	if provider.TokenID != "" {
 		if authResult, ok := provider.GetAuthResult().(tokens.CreateResult); ok {
 			token, err := authResult.ExtractToken()
 			if err != nil {
-				log.Warn("Failed to extract token, using default expiry", "error", err)
+				logging.FromContext(ctx).Warn("Failed to extract token, using default expiry", "error", err)
 			} else if token != nil {
 				tokenExpiry = token.ExpiresAt
 			} else {
-				log.Warn("Extracted token is nil, using default expiry")
+				logging.FromContext(ctx).Warn("Extracted token is nil, using default expiry")
 			}
 		}
 	}
-
-	client, err := authProvider.CreateDNSClient(provider, gophercloud.EndpointOpts{})
-	if err != nil {
-		return nil, time.Time{}, fmt.Errorf("failed to create Cloud DNS client: %v", err)
-	}
-
-	return client, tokenExpiry, nil
+	return tokenExpiry
 }
 
 func (p *RackspaceProvider) Records(ctx context.Context) ([]*endpoint.Endpoint, error) {
 	// Rackspace stores one target per record. external-dns expects one
 	// endpoint per name+type with all targets merged.
+	timer := prometheus.NewTimer(metrics.RecordsDuration)
+	defer timer.ObserveDuration()
+	ctx, span := tracing.Start(ctx, "Records")
 	merged := map[string]*endpoint.Endpoint{}
-	opts := domains.ListOpts{}
-	pager := p.getClient(ctx).ListDomains(ctx, opts)
+	managedDomains := 0
 	start := time.Now()
 
-	err := pager.EachPage(ctx, func(ctx context.Context, page pagination.Page) (bool, error) {
-		domainList, err := domains.ExtractDomains(page)
+	// Always read through to Cloud DNS here; this refills the cache that
+	// the following ApplyChanges call resolves domains and records from.
+	err := func() error {
+		domainList, err := p.fetchDomains(ctx)
 		if err != nil {
-			return false, err
+			return err
 		}
+		filter := p.negotiatedDomainFilter()
+		var zones []managedZone
 		for _, domain := range domainList {
-			if !p.DomainFilter.Match(domain.Name) {
+			if !p.matchZone(domain.Name) || !p.domainIDs.allows(domain.ID) {
 				continue
 			}
-			recordPager := p.getClient(ctx).ListRecords(ctx, domain.ID, records.ListOpts{})
-			err := recordPager.EachPage(ctx, func(ctx context.Context, recordPage pagination.Page) (bool, error) {
-				recordList, err := records.ExtractRecords(recordPage)
-				if err != nil {
-					return false, fmt.Errorf("failed to extract records: %w", err)
-				}
-				for _, record := range recordList {
-					if ep := convertRecordToEndpoint(record, domain.Name); ep != nil {
-						key := ep.DNSName + "/" + ep.RecordType
-						if existing, ok := merged[key]; ok {
-							existing.Targets = append(existing.Targets, ep.Targets...)
-						} else {
-							merged[key] = ep
-						}
+			managedDomains++
+			recordList, err := p.fetchZoneRecords(ctx, domain.ID)
+			if err != nil {
+				return fmt.Errorf("failed to list records for domain %s: %w", domain.Name, err)
+			}
+			zones = append(zones, managedZone{domain: domain, records: recordList})
+			for _, record := range recordList {
+				// Excluded names inside a managed zone, such as a sub-zone
+				// kept by hand, are left out entirely.
+				if ep := convertRecordToEndpoint(ctx, record, domain.Name); ep != nil && filter.Match(ep.DNSName) {
+					key := ep.DNSName + "/" + ep.RecordType
+					if existing, ok := merged[key]; ok {
+						existing.Targets = append(existing.Targets, ep.Targets...)
+					} else {
+						merged[key] = ep
 					}
 				}
-				return true, nil
-			})
-			if err != nil {
-				return false, fmt.Errorf("failed to list records for domain %s: %w", domain.Name, err)
 			}
 		}
-		return true, nil
-	})
+		// Delegation problems are logged rather than failing the listing,
+		// so they never hold up record changes.
+		if p.delegationEnabled() {
+			if err := p.reconcileDelegations(ctx, domainList, zones); err != nil {
+				logging.FromContext(ctx).Error("Failed to reconcile delegations", "error", err)
+			}
+		}
+		return nil
+	}()
+
+	p.recordSyncResult(err)
 
 	endpoints := make([]*endpoint.Endpoint, 0, len(merged))
 	for _, ep := range merged {
 		endpoints = append(endpoints, ep)
 	}
-	log.Debug("Fetched records", "count", len(endpoints), "elapsed", time.Since(start))
+	// As with delegations, a failed PTR lookup is logged and leaves the
+	// endpoints as they are.
+	if err == nil {
+		if err := p.reconcileReverseDNSProperties(ctx, endpoints); err != nil {
+			logging.FromContext(ctx).Error("Failed to check PTR records", "error", err)
+		}
+	}
+	logging.FromContext(ctx).Debug("Fetched records", "count", len(endpoints), "elapsed", time.Since(start))
+	span.SetAttributes(attribute.Int("managed_domains", managedDomains), attribute.Int("endpoints", len(endpoints)))
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch domains: %w", err)
+		err = fmt.Errorf("failed to fetch domains: %w", err)
+		tracing.End(span, err)
+		return nil, err
 	}
+	tracing.End(span, nil)
+	metrics.ManagedDomains.WithLabelValues(p.accountName()).Set(float64(managedDomains))
 
 	return endpoints, nil
 }
 
 // ApplyChanges applies DNS record changes to Rackspace Cloud DNS
-func (p *RackspaceProvider) ApplyChanges(ctx context.Context, changes *plan.Changes) error {
+func (p *RackspaceProvider) ApplyChanges(ctx context.Context, changes *plan.Changes) (err error) {
+	timer := prometheus.NewTimer(metrics.ApplyChangesDuration)
+	defer timer.ObserveDuration()
+	ctx, span := tracing.Start(ctx, "ApplyChanges", trace.WithAttributes(
+		attribute.Int("changes.create", len(changes.Create)),
+		attribute.Int("changes.update", len(changes.UpdateNew)),
+		attribute.Int("changes.delete", len(changes.Delete)),
+		attribute.Bool("dry_run", p.DryRun),
+	))
+	defer func() { tracing.End(span, err) }()
 	var errs []error
-	log.Info("Applying changes",
+	logging.FromContext(ctx).Info("Applying changes",
 		"create", len(changes.Create),
 		"updateNew", len(changes.UpdateNew),
 		"delete", len(changes.Delete),
 	)
 	if p.DryRun {
-		log.Info("Dry run enabled, skipping changes")
+		logging.FromContext(ctx).Info("Dry run enabled, skipping changes")
 		return nil
 	}
-
-	for _, ep := range changes.Delete {
-		if err := p.deleteRecord(ctx, ep); err != nil {
-			errs = append(errs, fmt.Errorf("failed to delete record %s: %v", ep.DNSName, err))
-		}
+	// Written zones are dropped from the cache once all changes are applied,
+	// rather than after every write, so large zones are not listed again
+	// for each endpoint.
+	ctx, written := withWrittenZones(ctx)
+	defer p.invalidateWritten(written)
+
+	if err := p.deleteRecords(ctx, changes.Delete); err != nil {
+		errs = append(errs, err)
 	}
 
-	for _, ep := range changes.Create {
-		if err := p.createRecord(ctx, ep); err != nil {
-			errs = append(errs, fmt.Errorf("failed to create record %s: %v", ep.DNSName, err))
-		}
+	if err := p.createRecords(ctx, changes.Create); err != nil {
+		errs = append(errs, err)
 	}
 
+	oldByKey := make(map[string]*endpoint.Endpoint, len(changes.UpdateOld))
+	for _, ep := range changes.UpdateOld {
+		oldByKey[endpointKey(ep)] = ep
+	}
 	for _, ep := range changes.UpdateNew {
-		if err := p.updateRecord(ctx, ep); err != nil {
+		if err := p.updateRecord(ctx, oldByKey[endpointKey(ep)], ep); err != nil {
 			errs = append(errs, fmt.Errorf("failed to update record %s: %v", ep.DNSName, err))
 		}
 	}
 
+	if err := p.applyReverseDNS(ctx, changes); err != nil {
+		errs = append(errs, err)
+	}
+	if p.ptrRecordsEnabled() {
+		// The reverse zones are read back to find their PTR records, so
+		// the writes above must not be served from the cache.
+		p.invalidateWritten(written)
+		if err := p.applyReverseZones(ctx, changes); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
 	if len(errs) == 0 {
 		return nil
 	}
 
-	log.Error("collected errors while applying changes", "count", len(errs))
+	logging.FromContext(ctx).Error("collected errors while applying changes", "count", len(errs))
 	for i, e := range errs {
-		log.Error("collected error", "index", i, "err", e)
+		logging.FromContext(ctx).Error("collected error", "index", i, "err", e)
 	}
 
 	return errors.Join(errs...)
 }
 
-func convertRecordToEndpoint(record records.RecordList, domainName string) *endpoint.Endpoint {
+// endpointKey pairs UpdateOld entries with their UpdateNew counterpart.
+func endpointKey(ep *endpoint.Endpoint) string {
+	return strings.TrimSuffix(strings.ToLower(ep.DNSName), ".") + "/" + ep.RecordType + "/" + ep.SetIdentifier
+}
+
+func convertRecordToEndpoint(ctx context.Context, record records.RecordList, domainName string) *endpoint.Endpoint {
 	if record.Type == "NS" || record.Type == "SOA" {
 		return nil
 	}
+	// PTR records kept in step with A and AAAA endpoints are not
+	// external-dns's to manage.
+	if record.Type == "PTR" && record.Comment == ptrComment {
+		return nil
+	}
 	// Comments may contain JSON labels (from external-dns) or plain text
 	// (from other tools). Only attempt to parse if it looks like JSON.
 	var labels map[string]string
 	if record.Type == "TXT" && record.Comment != "" && record.Comment[0] == '{' {
 		if err := json.Unmarshal([]byte(record.Comment), &labels); err != nil {
-			log.Warn("Failed to unmarshal TXT record labels", "name", record.Name, "comment", record.Comment, "error", err)
+			logging.FromContext(ctx).Warn("Failed to unmarshal TXT record labels", "name", record.Name, "comment", record.Comment, "error", err)
 		}
 	}
 
@@ -253,146 +447,448 @@ func convertRecordToEndpoint(record records.RecordList, domainName string) *endp
 			data = parts[0] + " " + parts[1] + " " + parts[2] + " " + parts[3] + "."
 		}
 	}
+	// MX preference is stored the same way as SRV priority. Reassemble into
+	// the "preference host" format and give the host a trailing dot so it
+	// matches what adjustEndpoints produces for the desired endpoints.
+	if record.Type == "MX" {
+		data = fmt.Sprintf("%d %s", record.Priority, record.Data)
+		if !strings.HasSuffix(data, ".") {
+			data += "."
+		}
+	}
 
-	return &endpoint.Endpoint{
+	ep := &endpoint.Endpoint{
 		DNSName:    record.Name,
 		RecordType: record.Type,
 		Targets:    []string{data},
 		RecordTTL:  endpoint.TTL(record.TTL),
 		Labels:     labels,
 	}
+	// A and AAAA records written with a device href remember it in their
+	// comment; report it back so external-dns sees the property as applied.
+	if (record.Type == endpoint.RecordTypeA || record.Type == endpoint.RecordTypeAAAA) && strings.HasPrefix(record.Comment, rdnsCommentPrefix) {
+		ep.WithProviderSpecific(rdnsHrefProperty, strings.TrimPrefix(record.Comment, rdnsCommentPrefix))
+	}
+	return ep
 }
 
 func (p *RackspaceProvider) createRecord(ctx context.Context, ep *endpoint.Endpoint) error {
+	return p.createRecords(ctx, []*endpoint.Endpoint{ep})
+}
+
+// createRecords creates every target of eps, grouped by zone so that each
+// zone receives one request per maxRecordsPerRequest records.
+func (p *RackspaceProvider) createRecords(ctx context.Context, eps []*endpoint.Endpoint) error {
+	var errs []error
+	var zones []*domains.DomainList
+	byZone := map[string][]records.CreateOpts{}
+
+	for _, ep := range eps {
+		domain, err := p.findDomain(ctx, ep.DNSName)
+		if errors.Is(err, errNoMatchingDomain) && p.zoneCreationEnabled() {
+			domain, err = p.createZone(ctx, ep.DNSName)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to create record %s: %v", ep.DNSName, err))
+			continue
+		}
+		var batch []records.CreateOpts
+		for _, target := range ep.Targets {
+			createOpts, err := buildCreateOpts(ep, target)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("failed to create record %s: %v", ep.DNSName, err))
+				batch = nil
+				break
+			}
+			batch = append(batch, createOpts)
+		}
+		if len(batch) == 0 {
+			continue
+		}
+		if _, ok := byZone[domain.ID]; !ok {
+			zones = append(zones, domain)
+		}
+		byZone[domain.ID] = append(byZone[domain.ID], batch...)
+	}
+
+	for _, domain := range zones {
+		if err := p.createInDomain(ctx, domain, byZone[domain.ID]); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// createInDomain sends want to Cloud DNS in as few requests as the
+// per-request limit allows.
+func (p *RackspaceProvider) createInDomain(ctx context.Context, domain *domains.DomainList, want []records.CreateOpts) error {
+	if len(want) == 0 {
+		return nil
+	}
+	if err := p.domainIDs.checkWrite(domain); err != nil {
+		return err
+	}
+	defer p.invalidateZone(ctx, domain.ID)
+
+	var errs []error
+	for start := 0; start < len(want); start += maxRecordsPerRequest {
+		batch := want[start:min(start+maxRecordsPerRequest, len(want))]
+		if err := p.createBatch(ctx, domain, batch); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// createBatch creates batch in one request. Cloud DNS fails the whole job
+// when a single record is bad or a duplicate, so a rejected batch is split
+// in half and each half sent again, until the records at fault fail on
+// their own and the rest are created.
+func (p *RackspaceProvider) createBatch(ctx context.Context, domain *domains.DomainList, batch []records.CreateOpts) error {
+	_, err := p.getClient(ctx).CreateRecords(ctx, domain.ID, batch)
+	if err == nil {
+		for _, opts := range batch {
+			logging.FromContext(ctx).Info("Created record", "dnsName", opts.Name, "type", opts.Type, "target", opts.Data)
+			metrics.RecordChanges.WithLabelValues("created", opts.Type).Inc()
+		}
+		return nil
+	}
+	if len(batch) > 1 && isRejectedBatch(err) {
+		logging.FromContext(ctx).Warn("Cloud DNS rejected a batch of records, splitting it", "domain", domain.Name, "records", len(batch), "error", err)
+		half := len(batch) / 2
+		return errors.Join(p.createBatch(ctx, domain, batch[:half]), p.createBatch(ctx, domain, batch[half:]))
+	}
+	names := make([]string, 0, len(batch))
+	for _, opts := range batch {
+		names = append(names, opts.Name)
+	}
+	return fmt.Errorf("failed to create records %s in domain %s: %w", strings.Join(names, ", "), domain.Name, err)
+}
+
+// isRejectedBatch reports whether Cloud DNS refused a create because of the
+// records in it, rather than because it could not be reached.
+func isRejectedBatch(err error) bool {
+	var jobErr *JobError
+	return errors.As(err, &jobErr) ||
+		gophercloud.ResponseCodeIs(err, http.StatusBadRequest) ||
+		gophercloud.ResponseCodeIs(err, http.StatusConflict)
+}
+
+// ownedComment reports whether a record's comment was written by this
+// webhook: external-dns labels on TXT records, or a device href on A and
+// AAAA records.
+func ownedComment(rec records.RecordList) bool {
+	switch rec.Type {
+	case endpoint.RecordTypeTXT:
+		return strings.HasPrefix(rec.Comment, "{")
+	case endpoint.RecordTypeA, endpoint.RecordTypeAAAA:
+		return strings.HasPrefix(rec.Comment, rdnsCommentPrefix)
+	}
+	return false
+}
+
+// buildCreateOpts translates one endpoint target into the shape the Cloud
+// DNS API stores it in, splitting SRV and MX priorities into their own field.
+func buildCreateOpts(ep *endpoint.Endpoint, target string) (records.CreateOpts, error) {
+	createOpts := records.CreateOpts{
+		Name: strings.TrimSuffix(strings.ToLower(ep.DNSName), "."),
+		Type: ep.RecordType,
+		Data: target,
+	}
+	if ep.RecordTTL.IsConfigured() {
+		createOpts.TTL = uint(ep.RecordTTL)
+	}
+
+	if ep.RecordType == "TXT" {
+		createOpts.Data = strings.Trim(target, `"`)
+		if len(ep.Labels) > 0 {
+			b, _ := json.Marshal(ep.Labels)
+			createOpts.Comment = string(b)
+		}
+	}
+	if href := rdnsHref(ep); href != "" {
+		createOpts.Comment = rdnsCommentPrefix + href
+	}
+
+	if ep.RecordType == "SRV" {
+		parts := strings.Split(target, " ")
+		if len(parts) != 4 {
+			return createOpts, fmt.Errorf("invalid SRV record format: %s", target)
+		}
+		// Priorities are 16-bit unsigned in DNS.
+		priority, err := strconv.ParseUint(parts[0], 10, 16)
+		if err != nil {
+			return createOpts, fmt.Errorf("invalid SRV priority %q: must be between 0 and 65535", parts[0])
+		}
+		createOpts.Priority = uint(priority)
+		createOpts.Data = fmt.Sprintf("%s %s %s", parts[1], parts[2], strings.TrimSuffix(parts[3], "."))
+	}
+
+	if ep.RecordType == "MX" {
+		parts := strings.Fields(target)
+		if len(parts) != 2 {
+			return createOpts, fmt.Errorf("invalid MX record format: %s", target)
+		}
+		// Priorities are 16-bit unsigned in DNS.
+		priority, err := strconv.ParseUint(parts[0], 10, 16)
+		if err != nil {
+			return createOpts, fmt.Errorf("invalid MX preference %q: must be between 0 and 65535", parts[0])
+		}
+		createOpts.Priority = uint(priority)
+		createOpts.Data = strings.TrimSuffix(parts[1], ".")
+	}
+
+	return createOpts, nil
+}
+
+// updateRecord reconciles the records behind one endpoint in place. Targets
+// present in both old and new are left alone (or have their comment and TTL
+// refreshed), removed targets are rewritten to carry added ones so record
+// IDs stay stable, and only the remainder is created or deleted. When old is
+// nil every existing record for the name and type is treated as replaceable.
+func (p *RackspaceProvider) updateRecord(ctx context.Context, old, ep *endpoint.Endpoint) error {
 	domain, err := p.findDomain(ctx, ep.DNSName)
 	if err != nil {
 		return err
 	}
-	fqdn := strings.TrimSuffix(strings.ToLower(ep.DNSName), ".")
-	for _, target := range ep.Targets {
-		createOpts := records.CreateOpts{
-			Name: fqdn,
-			Type: ep.RecordType,
-			Data: target,
-		}
+	existing, err := p.listRecordsByName(ctx, domain, ep.DNSName, ep.RecordType)
+	if err != nil {
+		return err
+	}
+	defer p.invalidateZone(ctx, domain.ID)
 
-		if ep.RecordType == "TXT" {
-			createOpts.Data = strings.Trim(target, `"`)
-			if len(ep.Labels) > 0 {
-				b, _ := json.Marshal(ep.Labels)
-				createOpts.Comment = string(b)
+	oldTargets := map[string]bool{}
+	if old != nil {
+		for _, target := range old.Targets {
+			if opts, err := buildCreateOpts(old, target); err == nil {
+				oldTargets[recordKey(opts.Data, opts.Priority)] = true
 			}
 		}
+	}
 
-		if ep.RecordType == "SRV" {
-			parts := strings.Split(target, " ")
-			if len(parts) != 4 {
-				log.Warn("Invalid SRV record format", "dnsName", ep.DNSName, "target", target)
-				return fmt.Errorf("invalid SRV record format: %s", target)
+	var errs []error
+	var missing []records.CreateOpts
+	matched := make([]bool, len(existing))
+	for _, target := range ep.Targets {
+		want, err := buildCreateOpts(ep, target)
+		if err != nil {
+			return err
+		}
+		idx := -1
+		for i, rec := range existing {
+			if !matched[i] && recordKey(rec.Data, rec.Priority) == recordKey(want.Data, want.Priority) {
+				idx = i
+				break
 			}
-			priority, err := strconv.Atoi(parts[0])
-			if err != nil {
-				log.Warn("Invalid SRV priority", "dnsName", ep.DNSName, "target", target)
-				return err
+		}
+		if idx < 0 {
+			missing = append(missing, want)
+			continue
+		}
+		matched[idx] = true
+		// Comments set by other tools or by hand are kept; only ones this
+		// webhook writes are brought in line.
+		commentChanged := existing[idx].Comment != want.Comment && (want.Comment != "" || ownedComment(existing[idx]))
+		if commentChanged || (want.TTL != 0 && existing[idx].TTL != want.TTL) {
+			if err := p.updateRecordInPlace(ctx, domain, existing[idx], want); err != nil {
+				errs = append(errs, err)
 			}
-			createOpts.Priority = uint(priority)
-			createOpts.Data = fmt.Sprintf("%s %s %s", parts[1], parts[2], strings.TrimSuffix(parts[3], "."))
 		}
+	}
 
-		if _, err := p.getClient(ctx).CreateRecord(ctx, domain.ID, createOpts); err != nil {
-			return fmt.Errorf("failed to create record %s: %v", ep.DNSName, err)
+	var stale []records.RecordList
+	for i, rec := range existing {
+		if matched[i] {
+			continue
+		}
+		if old == nil || oldTargets[recordKey(rec.Data, rec.Priority)] {
+			stale = append(stale, rec)
 		}
-		log.Info("Created record", "dnsName", ep.DNSName, "type", ep.RecordType, "target", target)
 	}
-	return nil
-}
 
-func (p *RackspaceProvider) updateRecord(ctx context.Context, endpoint *endpoint.Endpoint) error {
-	domain, err := p.findDomain(ctx, endpoint.DNSName)
-	if err != nil {
-		return err
+	var create []records.CreateOpts
+	for _, want := range missing {
+		// An update leaves out a zero priority, so it cannot lower one to 0.
+		if len(stale) == 0 || (want.Priority == 0 && stale[0].Priority != 0) {
+			create = append(create, want)
+			continue
+		}
+		if err := p.updateRecordInPlace(ctx, domain, stale[0], want); err != nil {
+			errs = append(errs, err)
+		}
+		stale = stale[1:]
 	}
 
-	if err := p.deleteRecordByName(ctx, domain, endpoint.DNSName, endpoint.RecordType); err != nil {
-		log.Warn("Failed to delete existing record during update", "dnsName", endpoint.DNSName, "error", err)
+	if err := p.createInDomain(ctx, domain, create); err != nil {
+		errs = append(errs, err)
 	}
 
-	return p.createRecord(ctx, endpoint)
+	if err := p.deleteInDomain(ctx, domain, stale); err != nil {
+		errs = append(errs, err)
+	}
+
+	return errors.Join(errs...)
 }
 
-func (p *RackspaceProvider) deleteRecord(ctx context.Context, endpoint *endpoint.Endpoint) error {
-	domain, err := p.findDomain(ctx, endpoint.DNSName)
-	if err != nil {
+func (p *RackspaceProvider) updateRecordInPlace(ctx context.Context, domain *domains.DomainList, rec records.RecordList, want records.CreateOpts) error {
+	if err := p.domainIDs.checkWrite(domain); err != nil {
 		return err
 	}
-	return p.deleteRecordByName(ctx, domain, endpoint.DNSName, endpoint.RecordType)
+	comment := want.Comment
+	if comment == "" && !ownedComment(rec) {
+		comment = rec.Comment
+	}
+	updateOpts := records.UpdateOpts{
+		Name:     want.Name,
+		Data:     want.Data,
+		TTL:      want.TTL,
+		Comment:  comment,
+		Priority: want.Priority,
+	}
+	if err := p.getClient(ctx).UpdateRecord(ctx, domain.ID, rec.ID, updateOpts); err != nil {
+		return fmt.Errorf("failed to update record %s: %w", rec.Name, err)
+	}
+	logging.FromContext(ctx).Info("Updated record", "dnsName", rec.Name, "type", rec.Type, "id", rec.ID, "from", rec.Data, "to", want.Data)
+	metrics.RecordChanges.WithLabelValues("updated", rec.Type).Inc()
+	return nil
 }
 
-func (p *RackspaceProvider) deleteRecordByName(ctx context.Context, domain *domains.DomainList, dnsName, recordType string) error {
-	if domain == nil {
-		return fmt.Errorf("domain cannot be nil")
-	}
-	wantName := strings.TrimSuffix(strings.ToLower(dnsName), ".")
-	pager := p.getClient(ctx).ListRecords(ctx, domain.ID, records.ListOpts{})
+// recordKey identifies a record by the fields that make up its target.
+func recordKey(data string, priority uint) string {
+	return fmt.Sprintf("%d %s", priority, strings.TrimSuffix(data, "."))
+}
 
+func (p *RackspaceProvider) deleteRecord(ctx context.Context, ep *endpoint.Endpoint) error {
+	return p.deleteRecords(ctx, []*endpoint.Endpoint{ep})
+}
+
+// deleteRecords removes every record behind eps, grouped by zone so that
+// each zone receives one request per maxRecordsPerRequest records.
+func (p *RackspaceProvider) deleteRecords(ctx context.Context, eps []*endpoint.Endpoint) error {
 	var errs []error
-	err := pager.EachPage(ctx, func(ctx context.Context, page pagination.Page) (bool, error) {
-		recordList, err := records.ExtractRecords(page)
+	var zones []*domains.DomainList
+	byZone := map[string][]records.RecordList{}
+	seen := map[string]bool{}
+
+	for _, ep := range eps {
+		domain, err := p.findDomain(ctx, ep.DNSName)
 		if err != nil {
-			return false, err
+			errs = append(errs, fmt.Errorf("failed to delete record %s: %v", ep.DNSName, err))
+			continue
+		}
+		recordList, err := p.listRecordsByName(ctx, domain, ep.DNSName, ep.RecordType)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to delete record %s: %v", ep.DNSName, err))
+			continue
+		}
+		if _, ok := byZone[domain.ID]; !ok {
+			zones = append(zones, domain)
 		}
-
 		for _, rec := range recordList {
-			gotName := strings.TrimSuffix(strings.ToLower(rec.Name), ".")
-			if gotName == wantName && strings.EqualFold(rec.Type, recordType) {
-				if e := p.getClient(ctx).DeleteRecord(ctx, domain.ID, rec.ID); e != nil {
-					errs = append(errs, fmt.Errorf("failed to delete record %s: %w", rec.Name, e))
-				} else {
-					log.Info("Deleted record", "dnsName", rec.Name, "type", recordType)
-				}
+			if !seen[rec.ID] {
+				seen[rec.ID] = true
+				byZone[domain.ID] = append(byZone[domain.ID], rec)
 			}
 		}
-		return true, nil
-	})
+	}
+
+	for _, domain := range zones {
+		if err := p.deleteInDomain(ctx, domain, byZone[domain.ID]); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// deleteInDomain removes recs from Cloud DNS in as few requests as the
+// per-request limit allows.
+func (p *RackspaceProvider) deleteInDomain(ctx context.Context, domain *domains.DomainList, recs []records.RecordList) error {
+	if len(recs) == 0 {
+		return nil
+	}
+	if err := p.domainIDs.checkWrite(domain); err != nil {
+		return err
+	}
+	defer p.invalidateZone(ctx, domain.ID)
+
+	var errs []error
+	for start := 0; start < len(recs); start += maxRecordsPerRequest {
+		batch := recs[start:min(start+maxRecordsPerRequest, len(recs))]
+		ids := make([]string, 0, len(batch))
+		names := make([]string, 0, len(batch))
+		for _, rec := range batch {
+			ids = append(ids, rec.ID)
+			names = append(names, rec.Name)
+		}
+		if err := p.getClient(ctx).DeleteRecords(ctx, domain.ID, ids); err != nil {
+			errs = append(errs, fmt.Errorf("failed to delete records %s in domain %s: %w", strings.Join(names, ", "), domain.Name, err))
+			continue
+		}
+		for _, rec := range batch {
+			logging.FromContext(ctx).Info("Deleted record", "dnsName", rec.Name, "type", rec.Type, "target", rec.Data)
+			metrics.RecordChanges.WithLabelValues("deleted", rec.Type).Inc()
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// listRecordsByName returns every record in domain with the given name and type.
+func (p *RackspaceProvider) listRecordsByName(ctx context.Context, domain *domains.DomainList, dnsName, recordType string) ([]records.RecordList, error) {
+	if domain == nil {
+		return nil, fmt.Errorf("domain cannot be nil")
+	}
+	wantName := strings.TrimSuffix(strings.ToLower(dnsName), ".")
+	recordList, err := p.listZoneRecords(ctx, domain.ID)
 	if err != nil {
-		return fmt.Errorf("failed to list records: %w", err)
+		return nil, fmt.Errorf("failed to list records: %w", err)
 	}
-	if len(errs) > 0 {
-		return errors.Join(errs...)
+
+	var found []records.RecordList
+	for _, rec := range recordList {
+		gotName := strings.TrimSuffix(strings.ToLower(rec.Name), ".")
+		if gotName == wantName && strings.EqualFold(rec.Type, recordType) {
+			found = append(found, rec)
+		}
 	}
-	return nil
+	return found, nil
 }
 
-func (p *RackspaceProvider) findDomain(ctx context.Context, dnsName string) (*domains.DomainList, error) {
+func (p *RackspaceProvider) findDomain(ctx context.Context, dnsName string) (_ *domains.DomainList, err error) {
+	ctx, span := tracing.Start(ctx, "findDomain", trace.WithAttributes(tracing.RecordNameKey.String(dnsName)))
+	defer func() { tracing.End(span, err) }()
 	if dnsName == "" {
 		return nil, fmt.Errorf("DNS name cannot be empty")
 	}
 	dnsName = strings.TrimSuffix(strings.ToLower(dnsName), ".")
-	opts := domains.ListOpts{}
-	pager := p.getClient(ctx).ListDomains(ctx, opts)
+	if !p.negotiatedDomainFilter().Match(dnsName) {
+		return nil, fmt.Errorf("%s is excluded by the domain filter", dnsName)
+	}
+	domainList, err := p.listDomains(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list domains: %w", err)
+	}
 
 	var bestMatch *domains.DomainList
-	err := pager.EachPage(ctx, func(ctx context.Context, page pagination.Page) (bool, error) {
-		domainList, err := domains.ExtractDomains(page)
-		if err != nil {
-			return false, fmt.Errorf("failed to extract domains: %w", err)
+	for _, domain := range domainList {
+		if !p.matchZone(domain.Name) {
+			continue
 		}
-		for _, domain := range domainList {
-			domainName := strings.TrimSuffix(strings.ToLower(domain.Name), ".")
-			if dnsName == domainName || strings.HasSuffix(dnsName, "."+domainName) {
-				if bestMatch == nil || len(domainName) > len(strings.TrimSuffix(strings.ToLower(bestMatch.Name), ".")) {
-					bestMatch = &domain
-				}
+		domainName := strings.TrimSuffix(strings.ToLower(domain.Name), ".")
+		if dnsName == domainName || strings.HasSuffix(dnsName, "."+domainName) {
+			if bestMatch == nil || len(domainName) > len(strings.TrimSuffix(strings.ToLower(bestMatch.Name), ".")) {
+				bestMatch = &domain
 			}
 		}
-		return true, nil
-	})
-
-	if err != nil {
-		return nil, fmt.Errorf("failed to list domains: %w", err)
 	}
+
 	if bestMatch == nil {
-		return nil, fmt.Errorf("no matching domain found for %s", dnsName)
+		return nil, fmt.Errorf("%w for %s", errNoMatchingDomain, dnsName)
+	}
+	// Falling back to a parent zone would write around a sub-zone that was
+	// deliberately left out, so an unlisted best match is an error.
+	if !p.domainIDs.allows(bestMatch.ID) {
+		return nil, fmt.Errorf("domain %s (%s) for %s is not in the domain ID filter", bestMatch.Name, bestMatch.ID, dnsName)
 	}
+	span.SetAttributes(tracing.DomainIDKey.String(bestMatch.ID), tracing.DomainNameKey.String(bestMatch.Name))
 	return bestMatch, nil
 }
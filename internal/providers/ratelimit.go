@@ -0,0 +1,242 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gophercloud/gophercloud/v2/pagination"
+	"github.com/rackerlabs/goclouddns/domains"
+	"github.com/rackerlabs/goclouddns/records"
+	"golang.org/x/time/rate"
+
+	"github.com/rackerlabs/external-dns-rackspace-webhook/internal/logging"
+)
+
+// RateLimits are client-side request budgets, in requests per minute, for
+// each class of Cloud DNS call. Zero leaves that class unlimited.
+type RateLimits struct {
+	List   int
+	Create int
+	Update int
+	Delete int
+}
+
+type operationClass string
+
+const (
+	classList   operationClass = "list"
+	classCreate operationClass = "create"
+	classUpdate operationClass = "update"
+	classDelete operationClass = "delete"
+)
+
+// rateLimiter holds one token bucket per operation class. Each bucket refills
+// at the configured per-minute rate and holds up to ten seconds' worth of
+// requests, so a sidecar cannot spend a whole minute's budget in one burst
+// when several clusters share the account. A nil limiter or a nil bucket
+// does not limit.
+type rateLimiter struct {
+	buckets map[operationClass]*rate.Limiter
+}
+
+func newRateLimiter(limits RateLimits) *rateLimiter {
+	l := &rateLimiter{buckets: map[operationClass]*rate.Limiter{}}
+	for class, perMinute := range map[operationClass]int{
+		classList:   limits.List,
+		classCreate: limits.Create,
+		classUpdate: limits.Update,
+		classDelete: limits.Delete,
+	} {
+		if perMinute > 0 {
+			l.buckets[class] = rate.NewLimiter(rate.Limit(float64(perMinute)/60), max(1, perMinute/6))
+		}
+	}
+	return l
+}
+
+// wait blocks until a request of the given class may be sent or ctx is done.
+func (l *rateLimiter) wait(ctx context.Context, class operationClass) error {
+	if l == nil || l.buckets[class] == nil {
+		return nil
+	}
+	if err := l.buckets[class].Wait(ctx); err != nil {
+		return fmt.Errorf("rate limiter (%s): %w", class, err)
+	}
+	return nil
+}
+
+// rateLimitedServiceClient waits for a token from the matching bucket before
+// every ServiceClient call. List calls take one token when the pager is
+// created; eachPageWithRetry takes one for every further page.
+type rateLimitedServiceClient struct {
+	ServiceClient
+	limiter *rateLimiter
+}
+
+func newRateLimitedServiceClient(next ServiceClient, limiter *rateLimiter) ServiceClient {
+	return &rateLimitedServiceClient{ServiceClient: next, limiter: limiter}
+}
+
+func (r *rateLimitedServiceClient) ListDomains(ctx context.Context, opts domains.ListOpts) pagination.Pager {
+	if err := r.limiter.wait(ctx, classList); err != nil {
+		return pagination.Pager{Err: err}
+	}
+	return r.ServiceClient.ListDomains(ctx, opts)
+}
+
+func (r *rateLimitedServiceClient) ListRecords(ctx context.Context, domainID string, opts records.ListOpts) pagination.Pager {
+	if err := r.limiter.wait(ctx, classList); err != nil {
+		return pagination.Pager{Err: err}
+	}
+	return r.ServiceClient.ListRecords(ctx, domainID, opts)
+}
+
+func (r *rateLimitedServiceClient) CreateRecord(ctx context.Context, domainID string, opts records.CreateOpts) (*records.RecordList, error) {
+	if err := r.limiter.wait(ctx, classCreate); err != nil {
+		return nil, err
+	}
+	return r.ServiceClient.CreateRecord(ctx, domainID, opts)
+}
+
+func (r *rateLimitedServiceClient) CreateRecords(ctx context.Context, domainID string, opts []records.CreateOpts) ([]records.RecordList, error) {
+	if err := r.limiter.wait(ctx, classCreate); err != nil {
+		return nil, err
+	}
+	return r.ServiceClient.CreateRecords(ctx, domainID, opts)
+}
+
+func (r *rateLimitedServiceClient) CreateDomain(ctx context.Context, opts domains.CreateOpts) (*domains.DomainList, error) {
+	if err := r.limiter.wait(ctx, classCreate); err != nil {
+		return nil, err
+	}
+	return r.ServiceClient.CreateDomain(ctx, opts)
+}
+
+func (r *rateLimitedServiceClient) ListPTRRecords(ctx context.Context, service, href string) ([]records.RecordList, error) {
+	if err := r.limiter.wait(ctx, classList); err != nil {
+		return nil, err
+	}
+	return r.ServiceClient.ListPTRRecords(ctx, service, href)
+}
+
+func (r *rateLimitedServiceClient) AddPTRRecords(ctx context.Context, service, href string, opts []records.CreateOpts) error {
+	if err := r.limiter.wait(ctx, classCreate); err != nil {
+		return err
+	}
+	return r.ServiceClient.AddPTRRecords(ctx, service, href, opts)
+}
+
+func (r *rateLimitedServiceClient) DeletePTRRecord(ctx context.Context, service, href, ip string) error {
+	if err := r.limiter.wait(ctx, classDelete); err != nil {
+		return err
+	}
+	return r.ServiceClient.DeletePTRRecord(ctx, service, href, ip)
+}
+
+func (r *rateLimitedServiceClient) UpdateRecord(ctx context.Context, domainID, recordID string, opts records.UpdateOpts) error {
+	if err := r.limiter.wait(ctx, classUpdate); err != nil {
+		return err
+	}
+	return r.ServiceClient.UpdateRecord(ctx, domainID, recordID, opts)
+}
+
+func (r *rateLimitedServiceClient) DeleteRecord(ctx context.Context, domainID, recordID string) error {
+	if err := r.limiter.wait(ctx, classDelete); err != nil {
+		return err
+	}
+	return r.ServiceClient.DeleteRecord(ctx, domainID, recordID)
+}
+
+func (r *rateLimitedServiceClient) DeleteRecords(ctx context.Context, domainID string, recordIDs []string) error {
+	if err := r.limiter.wait(ctx, classDelete); err != nil {
+		return err
+	}
+	return r.ServiceClient.DeleteRecords(ctx, domainID, recordIDs)
+}
+
+// AccountLimits is the subset of the Cloud DNS /limits resource used to
+// size the client-side rate limiter.
+type AccountLimits struct {
+	Rate []struct {
+		URI   string `json:"uri"`
+		Limit []struct {
+			Verb  string `json:"verb"`
+			Value int    `json:"value"`
+			Unit  string `json:"unit"`
+		} `json:"limit"`
+	} `json:"rate"`
+}
+
+// perMinute converts the account's domain and record rate limits into
+// RateLimits. Verbs map onto classes as GET=list, POST=create, PUT=update
+// and DELETE=delete.
+func (a *AccountLimits) perMinute() RateLimits {
+	var limits RateLimits
+	for _, entry := range a.Rate {
+		if !strings.Contains(strings.ToLower(entry.URI), "domains") {
+			continue
+		}
+		for _, limit := range entry.Limit {
+			var unit time.Duration
+			switch strings.ToUpper(limit.Unit) {
+			case "SECOND":
+				unit = time.Second
+			case "MINUTE":
+				unit = time.Minute
+			case "HOUR":
+				unit = time.Hour
+			case "DAY":
+				unit = 24 * time.Hour
+			default:
+				continue
+			}
+			value := max(1, int(float64(limit.Value)*float64(time.Minute)/float64(unit)))
+			switch strings.ToUpper(limit.Verb) {
+			case "GET":
+				limits.List = value
+			case "POST":
+				limits.Create = value
+			case "PUT":
+				limits.Update = value
+			case "DELETE":
+				limits.Delete = value
+			}
+		}
+	}
+	return limits
+}
+
+// mergeRateLimits keeps, per class, the stricter of the configured and the
+// account limit. A class left unlimited in configuration takes the account value.
+func mergeRateLimits(configured, account RateLimits) RateLimits {
+	stricter := func(a, b int) int {
+		switch {
+		case a <= 0:
+			return b
+		case b <= 0:
+			return a
+		default:
+			return min(a, b)
+		}
+	}
+	return RateLimits{
+		List:   stricter(configured.List, account.List),
+		Create: stricter(configured.Create, account.Create),
+		Update: stricter(configured.Update, account.Update),
+		Delete: stricter(configured.Delete, account.Delete),
+	}
+}
+
+// loadAccountRateLimits reads /limits and combines it with the configured limits.
+func loadAccountRateLimits(ctx context.Context, client ServiceClient, configured RateLimits) RateLimits {
+	account, err := client.GetLimits(ctx)
+	if err != nil {
+		logging.FromContext(ctx).Warn("Failed to read account limits, using configured rate limits", "error", err)
+		return configured
+	}
+	limits := mergeRateLimits(configured, account.perMinute())
+	logging.FromContext(ctx).Info("Loaded account rate limits", "list", limits.List, "create", limits.Create, "update", limits.Update, "delete", limits.Delete)
+	return limits
+}
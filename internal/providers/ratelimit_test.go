@@ -0,0 +1,82 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/rackerlabs/goclouddns/records"
+
+	th "github.com/gophercloud/gophercloud/v2/testhelper"
+)
+
+func TestRateLimitedServiceClient_WaitsForToken(t *testing.T) {
+	fakeServer := th.SetupHTTP()
+	defer fakeServer.Teardown()
+
+	calls := 0
+	fakeServer.Mux.HandleFunc("/domains/111/records", func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		_, _ = fmt.Fprint(w, `{"status":"COMPLETED","response":{"records":[]}}`)
+	})
+
+	// One create per minute: the first call spends the only token.
+	client := newRateLimitedServiceClient(NewRackspaceDNSClient(FakeDNSClient(fakeServer.Endpoint())), newRateLimiter(RateLimits{Create: 1}))
+	opts := []records.CreateOpts{{Name: "a.example.com", Type: "A", Data: "10.0.0.1"}}
+	if _, err := client.CreateRecords(context.Background(), "111", opts); err != nil {
+		t.Fatalf("first CreateRecords() error = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := client.CreateRecords(ctx, "111", opts)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the limiter to block until cancellation, got %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("expected 1 request to reach Cloud DNS, got %d", calls)
+	}
+}
+
+func TestRackspaceDNSClient_GetLimits(t *testing.T) {
+	fakeServer := th.SetupHTTP()
+	defer fakeServer.Teardown()
+
+	fakeServer.Mux.HandleFunc("/limits", func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, "GET")
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprint(w, `{"limits":{"rate":[
+			{"uri":"*/status/*","limit":[{"verb":"GET","value":5,"unit":"SECOND"}]},
+			{"uri":"*/domains*","limit":[
+				{"verb":"GET","value":60,"unit":"MINUTE"},
+				{"verb":"POST","value":240,"unit":"HOUR"},
+				{"verb":"PUT","value":1,"unit":"SECOND"},
+				{"verb":"DELETE","value":100,"unit":"MINUTE"}
+			]}
+		],"absolute":{"domains":500}}}`)
+	})
+
+	limits, err := NewRackspaceDNSClient(FakeDNSClient(fakeServer.Endpoint())).GetLimits(context.Background())
+	if err != nil {
+		t.Fatalf("GetLimits() error = %v", err)
+	}
+
+	want := RateLimits{List: 60, Create: 4, Update: 60, Delete: 100}
+	if got := limits.perMinute(); got != want {
+		t.Errorf("perMinute() = %+v, want %+v", got, want)
+	}
+}
+
+func TestMergeRateLimits(t *testing.T) {
+	configured := RateLimits{List: 100, Create: 25, Update: 0, Delete: 50}
+	account := RateLimits{List: 60, Create: 100, Update: 60, Delete: 0}
+
+	want := RateLimits{List: 60, Create: 25, Update: 60, Delete: 50}
+	if got := mergeRateLimits(configured, account); got != want {
+		t.Errorf("mergeRateLimits() = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,215 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/rackerlabs/goclouddns/records"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+
+	"github.com/rackerlabs/external-dns-rackspace-webhook/internal/logging"
+	"github.com/rackerlabs/external-dns-rackspace-webhook/internal/metrics"
+)
+
+const (
+	// rdnsHrefProperty links an A or AAAA endpoint to the Cloud Server or
+	// Cloud Load Balancer whose reverse DNS should point back at it. It is
+	// set with the external-dns.alpha.kubernetes.io/webhook-rdns-href
+	// annotation.
+	rdnsHrefProperty = "webhook/rdns-href"
+	// rdnsCommentPrefix stores the device href in the forward record's
+	// comment, so Records can tell which device to check.
+	rdnsCommentPrefix = "rdns:"
+
+	rdnsServiceServers       = "cloudServersOpenStack"
+	rdnsServiceLoadBalancers = "cloudLoadBalancers"
+)
+
+// rdnsService returns the rdns service name for a device href.
+func rdnsService(href string) string {
+	if strings.Contains(strings.ToLower(href), "/loadbalancers/") {
+		return rdnsServiceLoadBalancers
+	}
+	return rdnsServiceServers
+}
+
+// rdnsHref returns the device href of an A or AAAA endpoint, if any.
+func rdnsHref(ep *endpoint.Endpoint) string {
+	if ep == nil || (ep.RecordType != endpoint.RecordTypeA && ep.RecordType != endpoint.RecordTypeAAAA) {
+		return ""
+	}
+	href, _ := ep.GetProviderSpecificProperty(rdnsHrefProperty)
+	return strings.TrimSpace(href)
+}
+
+// ptrKey identifies a PTR record by device and address.
+type ptrKey struct {
+	href string
+	ip   string
+}
+
+// ptrRecord is a PTR record wanted for, or previously set by, an endpoint.
+type ptrRecord struct {
+	name string
+	ttl  uint
+}
+
+// collectPTRs gathers the PTR records that eps ask for.
+func collectPTRs(eps []*endpoint.Endpoint, into map[ptrKey]ptrRecord) {
+	for _, ep := range eps {
+		href := rdnsHref(ep)
+		if href == "" {
+			continue
+		}
+		var ttl uint
+		if ep.RecordTTL.IsConfigured() {
+			ttl = uint(ep.RecordTTL)
+		}
+		for _, ip := range ep.Targets {
+			into[ptrKey{href: href, ip: ip}] = ptrRecord{name: normalizeDomain(ep.DNSName), ttl: ttl}
+		}
+	}
+}
+
+// listPTRNames returns the names a device's PTR records point at, by IP.
+func (p *RackspaceProvider) listPTRNames(ctx context.Context, href string) (map[string]string, error) {
+	existing, err := p.getClient(ctx).ListPTRRecords(ctx, rdnsService(href), href)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list PTR records on %s: %w", href, err)
+	}
+	names := make(map[string]string, len(existing))
+	for _, rec := range existing {
+		names[rec.Data] = normalizeDomain(rec.Name)
+	}
+	return names, nil
+}
+
+// applyReverseDNS brings device PTR records in line with changes: PTRs of
+// deleted or replaced targets are removed, and missing PTRs of created or
+// updated targets are added. A PTR record pointing at a name other than the
+// one the endpoint set is never touched. It runs after the forward records
+// are written.
+func (p *RackspaceProvider) applyReverseDNS(ctx context.Context, changes *plan.Changes) error {
+	previous := map[ptrKey]ptrRecord{}
+	collectPTRs(changes.Delete, previous)
+	collectPTRs(changes.UpdateOld, previous)
+	desired := map[ptrKey]ptrRecord{}
+	collectPTRs(changes.Create, desired)
+	collectPTRs(changes.UpdateNew, desired)
+	if len(previous) == 0 && len(desired) == 0 {
+		return nil
+	}
+
+	var errs []error
+	byHref := map[string][]ptrKey{}
+	for key := range desired {
+		byHref[key.href] = append(byHref[key.href], key)
+	}
+	names := map[string]map[string]string{}
+	for _, keys := range []map[ptrKey]ptrRecord{previous, desired} {
+		for key := range keys {
+			if _, ok := names[key.href]; ok {
+				continue
+			}
+			have, err := p.listPTRNames(ctx, key.href)
+			if err != nil {
+				errs = append(errs, err)
+			}
+			// A nil entry marks a failed listing; the device is left alone.
+			names[key.href] = have
+		}
+	}
+
+	for key, old := range previous {
+		if want, ok := desired[key]; ok && want.name == old.name {
+			continue
+		}
+		have := names[key.href]
+		if name, ok := have[key.ip]; !ok || name != old.name {
+			// Already gone, or since pointed at another name.
+			continue
+		}
+		if err := p.getClient(ctx).DeletePTRRecord(ctx, rdnsService(key.href), key.href, key.ip); err != nil {
+			errs = append(errs, fmt.Errorf("failed to delete PTR record for %s on %s: %w", key.ip, key.href, err))
+			continue
+		}
+		delete(have, key.ip)
+		logging.FromContext(ctx).Info("Deleted PTR record", "ip", key.ip, "name", old.name, "href", key.href)
+		metrics.RecordChanges.WithLabelValues("deleted", "PTR").Inc()
+	}
+
+	hrefs := make([]string, 0, len(byHref))
+	for href := range byHref {
+		hrefs = append(hrefs, href)
+	}
+	sort.Strings(hrefs)
+
+	for _, href := range hrefs {
+		have := names[href]
+		if have == nil {
+			continue
+		}
+		var add []records.CreateOpts
+		for _, key := range byHref[href] {
+			want := desired[key]
+			if name, ok := have[key.ip]; ok {
+				if name != want.name {
+					errs = append(errs, fmt.Errorf("PTR record for %s on %s points at %s, not replacing it with %s", key.ip, href, name, want.name))
+				}
+				continue
+			}
+			add = append(add, records.CreateOpts{Name: want.name, Type: "PTR", Data: key.ip, TTL: want.ttl})
+		}
+		if len(add) == 0 {
+			continue
+		}
+		if err := p.getClient(ctx).AddPTRRecords(ctx, rdnsService(href), href, add); err != nil {
+			errs = append(errs, fmt.Errorf("failed to add PTR records on %s: %w", href, err))
+			continue
+		}
+		for _, opts := range add {
+			logging.FromContext(ctx).Info("Created PTR record", "ip", opts.Data, "name", opts.Name, "href", href)
+			metrics.RecordChanges.WithLabelValues("created", "PTR").Inc()
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// reconcileReverseDNSProperties checks the PTR records behind every endpoint
+// carrying a device href. When a PTR record is missing the href is dropped
+// from the endpoint, so external-dns sees a difference and plans an update
+// that recreates it.
+func (p *RackspaceProvider) reconcileReverseDNSProperties(ctx context.Context, eps []*endpoint.Endpoint) error {
+	ptrs := map[string]map[string]string{}
+	var errs []error
+	for _, ep := range eps {
+		href := rdnsHref(ep)
+		if href == "" {
+			continue
+		}
+		have, ok := ptrs[href]
+		if !ok {
+			var err error
+			if have, err = p.listPTRNames(ctx, href); err != nil {
+				// Leave the endpoint as it is rather than trigger updates
+				// because of a failed lookup.
+				errs = append(errs, err)
+			}
+			ptrs[href] = have
+		}
+		if have == nil {
+			continue
+		}
+		for _, ip := range ep.Targets {
+			if have[ip] != normalizeDomain(ep.DNSName) {
+				ep.DeleteProviderSpecificProperty(rdnsHrefProperty)
+				break
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,228 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+
+	th "github.com/gophercloud/gophercloud/v2/testhelper"
+	"github.com/rackerlabs/goclouddns/records"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+const testServerHref = "https://dfw.servers.api.rackspacecloud.com/v2/123/servers/abc"
+
+func TestRecords_ReportsReverseDNS(t *testing.T) {
+	fakeServer := th.SetupHTTP()
+	defer fakeServer.Teardown()
+
+	fakeServer.Mux.HandleFunc("/domains", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprint(w, `{"domains":[{"id":"111","name":"example.com"}]}`)
+	})
+	fakeServer.Mux.HandleFunc("/domains/111/records", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprint(w, `{"records":[
+			{"id":"r1","name":"www.example.com","type":"A","data":"10.0.0.1","ttl":300,"comment":"rdns:`+testServerHref+`"},
+			{"id":"r2","name":"api.example.com","type":"A","data":"10.0.0.2","ttl":300,"comment":"rdns:`+testServerHref+`"}
+		]}`)
+	})
+	lists := 0
+	fakeServer.Mux.HandleFunc("/rdns/cloudServersOpenStack", func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, "GET")
+		th.TestFormValues(t, r, map[string]string{"href": testServerHref})
+		lists++
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprint(w, `{"records":[{"id":"PTR-1","name":"www.example.com","type":"PTR","data":"10.0.0.1","ttl":300}]}`)
+	})
+
+	p := newTestProvider(t, fakeServer.Endpoint())
+	endpoints, err := p.Records(context.Background())
+	if err != nil {
+		t.Fatalf("Records() error: %v", err)
+	}
+	if lists != 1 {
+		t.Errorf("expected the device's PTR records to be listed once, got %d", lists)
+	}
+	for _, ep := range endpoints {
+		href, ok := ep.GetProviderSpecificProperty(rdnsHrefProperty)
+		switch ep.DNSName {
+		case "www.example.com":
+			if !ok || href != testServerHref {
+				t.Errorf("expected www.example.com to report its device href, got %v", ep.ProviderSpecific)
+			}
+		case "api.example.com":
+			if ok {
+				t.Errorf("expected api.example.com to drop the href since its PTR record is missing, got %v", ep.ProviderSpecific)
+			}
+		}
+	}
+}
+
+func TestApplyChanges_ReverseDNS(t *testing.T) {
+	fakeServer := th.SetupHTTP()
+	defer fakeServer.Teardown()
+
+	var mu sync.Mutex
+	var forward []records.CreateOpts
+	var added []records.CreateOpts
+	var addedRel string
+	var deletedIPs []string
+
+	fakeServer.Mux.HandleFunc("/domains", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprint(w, `{"domains":[{"id":"111","name":"example.com"}]}`)
+	})
+	fakeServer.Mux.HandleFunc("/domains/111/records", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		switch r.Method {
+		case http.MethodGet:
+			_, _ = fmt.Fprint(w, `{"records":[{"id":"r1","name":"old.example.com","type":"A","data":"10.0.0.9","ttl":300,"comment":"rdns:`+testServerHref+`"}]}`)
+		case http.MethodPost:
+			var payload struct {
+				Records []records.CreateOpts `json:"records"`
+			}
+			_ = json.NewDecoder(r.Body).Decode(&payload)
+			forward = append(forward, payload.Records...)
+			w.WriteHeader(http.StatusAccepted)
+			_, _ = fmt.Fprint(w, `{"status":"COMPLETED","response":{"records":[{"id":"r2"}]}}`)
+		case http.MethodDelete:
+			w.WriteHeader(http.StatusAccepted)
+			_, _ = fmt.Fprint(w, `{"status":"COMPLETED"}`)
+		}
+	})
+	fakeServer.Mux.HandleFunc("/rdns", func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, "POST")
+		mu.Lock()
+		defer mu.Unlock()
+		var payload struct {
+			RecordsList struct {
+				Records []records.CreateOpts `json:"records"`
+			} `json:"recordsList"`
+			Link struct {
+				Href string `json:"href"`
+				Rel  string `json:"rel"`
+			} `json:"link"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&payload)
+		if payload.Link.Href != testServerHref {
+			t.Errorf("unexpected device href %q", payload.Link.Href)
+		}
+		added = append(added, payload.RecordsList.Records...)
+		addedRel = payload.Link.Rel
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		_, _ = fmt.Fprint(w, `{"status":"COMPLETED"}`)
+	})
+	fakeServer.Mux.HandleFunc("/rdns/cloudServersOpenStack", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		switch r.Method {
+		case http.MethodGet:
+			_, _ = fmt.Fprint(w, `{"records":[
+				{"id":"PTR-1","name":"old.example.com","type":"PTR","data":"10.0.0.9","ttl":300},
+				{"id":"PTR-2","name":"other.example.com","type":"PTR","data":"10.0.0.8","ttl":300}
+			]}`)
+		case http.MethodDelete:
+			deletedIPs = append(deletedIPs, r.URL.Query().Get("ip"))
+			w.WriteHeader(http.StatusAccepted)
+			_, _ = fmt.Fprint(w, `{"status":"COMPLETED"}`)
+		}
+	})
+
+	p := newTestProvider(t, fakeServer.Endpoint())
+	changes := &plan.Changes{
+		Create: []*endpoint.Endpoint{
+			endpoint.NewEndpointWithTTL("www.example.com", endpoint.RecordTypeA, 600, "10.0.0.1").
+				WithProviderSpecific(rdnsHrefProperty, testServerHref),
+		},
+		Delete: []*endpoint.Endpoint{
+			endpoint.NewEndpoint("old.example.com", endpoint.RecordTypeA, "10.0.0.9").
+				WithProviderSpecific(rdnsHrefProperty, testServerHref),
+			// Its PTR record has since been pointed at another name.
+			endpoint.NewEndpoint("gone.example.com", endpoint.RecordTypeA, "10.0.0.8").
+				WithProviderSpecific(rdnsHrefProperty, testServerHref),
+		},
+	}
+	if err := p.ApplyChanges(context.Background(), changes); err != nil {
+		t.Fatalf("ApplyChanges() error: %v", err)
+	}
+
+	if len(forward) != 1 || forward[0].Comment != rdnsCommentPrefix+testServerHref {
+		t.Errorf("expected the forward record to remember its device href, got %+v", forward)
+	}
+	if len(deletedIPs) != 1 || deletedIPs[0] != "10.0.0.9" {
+		t.Errorf("expected only the PTR record still pointing at the deleted endpoint to be removed, got %v", deletedIPs)
+	}
+	if len(added) != 1 {
+		t.Fatalf("expected one PTR record to be added, got %+v", added)
+	}
+	if got := added[0]; got.Name != "www.example.com" || got.Type != "PTR" || got.Data != "10.0.0.1" || got.TTL != 600 {
+		t.Errorf("unexpected PTR record: %+v", got)
+	}
+	if addedRel != rdnsServiceServers {
+		t.Errorf("expected the PTR record to be linked to %s, got %q", rdnsServiceServers, addedRel)
+	}
+}
+
+func TestApplyChanges_ReverseDNSFirstPTR(t *testing.T) {
+	fakeServer := th.SetupHTTP()
+	defer fakeServer.Teardown()
+
+	fakeServer.Mux.HandleFunc("/domains", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprint(w, `{"domains":[{"id":"111","name":"example.com"}]}`)
+	})
+	fakeServer.Mux.HandleFunc("/domains/111/records", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == http.MethodPost {
+			w.WriteHeader(http.StatusAccepted)
+			_, _ = fmt.Fprint(w, `{"status":"COMPLETED","response":{"records":[{"id":"r1"}]}}`)
+			return
+		}
+		_, _ = fmt.Fprint(w, `{"records":[]}`)
+	})
+	// A device without PTR records answers the listing with 404.
+	fakeServer.Mux.HandleFunc("/rdns/cloudServersOpenStack", func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, "GET")
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = fmt.Fprint(w, `{"itemNotFound":{"message":"Not found","code":404}}`)
+	})
+	adds := 0
+	fakeServer.Mux.HandleFunc("/rdns", func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, "POST")
+		adds++
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		_, _ = fmt.Fprint(w, `{"status":"COMPLETED"}`)
+	})
+
+	p := newTestProvider(t, fakeServer.Endpoint())
+	changes := &plan.Changes{Create: []*endpoint.Endpoint{
+		endpoint.NewEndpoint("www.example.com", endpoint.RecordTypeA, "10.0.0.1").
+			WithProviderSpecific(rdnsHrefProperty, testServerHref),
+	}}
+	if err := p.ApplyChanges(context.Background(), changes); err != nil {
+		t.Fatalf("ApplyChanges() error: %v", err)
+	}
+	if adds != 1 {
+		t.Errorf("expected the first PTR record to be added, got %d requests", adds)
+	}
+}
+
+func TestRdnsService(t *testing.T) {
+	if got := rdnsService(testServerHref); got != rdnsServiceServers {
+		t.Errorf("rdnsService(server) = %q", got)
+	}
+	if got := rdnsService("https://dfw.loadbalancers.api.rackspacecloud.com/v1.0/123/loadbalancers/42"); got != rdnsServiceLoadBalancers {
+		t.Errorf("rdnsService(load balancer) = %q", got)
+	}
+}
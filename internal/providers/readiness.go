@@ -0,0 +1,81 @@
+package providers
+
+import (
+	"time"
+
+	"github.com/rackerlabs/external-dns-rackspace-webhook/internal/logging"
+)
+
+// syncFailureThreshold is how many syncs in a row must fail to list Cloud
+// DNS before the provider reports not ready. A sync is one Records call,
+// which lists every managed zone, so a zone that fails on every sync counts
+// even while its siblings list fine. List calls are already retried, so a
+// single failed sync is usually transient and would only make /readyz flap.
+const syncFailureThreshold = 3
+
+// ReadinessCheck is the outcome of a single readiness condition.
+type ReadinessCheck struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+// Readiness reports whether the provider can currently talk to Cloud DNS,
+// with a breakdown of each condition that feeds into the decision.
+type Readiness struct {
+	Ready  bool                      `json:"-"`
+	Checks map[string]ReadinessCheck `json:"checks"`
+	Token  TokenStatus               `json:"tokenRefresh"`
+	// Accounts holds the token status of each account when several are
+	// configured, in place of Token.
+	Accounts map[string]TokenStatus `json:"accounts,omitempty"`
+}
+
+// Readiness evaluates the last authentication attempt, the token lifetime
+// and the recent syncs, and reports the token refresh status.
+func (p *RackspaceProvider) Readiness() Readiness {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	checks := map[string]ReadinessCheck{
+		"authentication": checkFromError(p.lastAuthErr),
+		"cloudDNS":       checkFromError(p.lastListErr),
+	}
+	if p.lastListErr != nil && p.failedSyncs < syncFailureThreshold {
+		// Still report the error, without failing the check.
+		checks["cloudDNS"] = ReadinessCheck{OK: true, Error: checks["cloudDNS"].Error}
+	}
+	switch {
+	case p.tokenExpiry.IsZero():
+		checks["token"] = ReadinessCheck{Error: "no token has been issued"}
+	case time.Now().After(p.tokenExpiry):
+		checks["token"] = ReadinessCheck{Error: "token expired at " + p.tokenExpiry.Format(time.RFC3339)}
+	default:
+		checks["token"] = ReadinessCheck{OK: true}
+	}
+
+	ready := true
+	for _, check := range checks {
+		ready = ready && check.OK
+	}
+	return Readiness{Ready: ready, Checks: checks, Token: p.tokenStatusLocked()}
+}
+
+// recordSyncResult remembers whether the latest sync listed every managed
+// zone, and counts consecutive failed syncs.
+func (p *RackspaceProvider) recordSyncResult(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.lastListErr = err
+	if err == nil {
+		p.failedSyncs = 0
+	} else {
+		p.failedSyncs++
+	}
+}
+
+func checkFromError(err error) ReadinessCheck {
+	if err != nil {
+		return ReadinessCheck{Error: logging.Redact(err.Error())}
+	}
+	return ReadinessCheck{OK: true}
+}
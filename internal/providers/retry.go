@@ -0,0 +1,250 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gophercloud/gophercloud/v2"
+	"github.com/gophercloud/gophercloud/v2/pagination"
+	"github.com/rackerlabs/goclouddns/domains"
+	"github.com/rackerlabs/goclouddns/records"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/rackerlabs/external-dns-rackspace-webhook/internal/logging"
+)
+
+const (
+	defaultRetryMaxAttempts = 5
+	defaultRetryBaseDelay   = 1 * time.Second
+	defaultRetryMaxDelay    = 30 * time.Second
+)
+
+// retryPolicy decides whether and when a failed Cloud DNS call is retried.
+// A nil policy makes a single attempt.
+type retryPolicy struct {
+	maxAttempts int
+	baseDelay   time.Duration
+	maxDelay    time.Duration
+}
+
+func newRetryPolicy(maxAttempts int) *retryPolicy {
+	if maxAttempts <= 0 {
+		maxAttempts = defaultRetryMaxAttempts
+	}
+	return &retryPolicy{
+		maxAttempts: maxAttempts,
+		baseDelay:   defaultRetryBaseDelay,
+		maxDelay:    defaultRetryMaxDelay,
+	}
+}
+
+// do runs fn until it succeeds, returns a non-retryable error, the attempt
+// limit is reached, or ctx is cancelled. Between attempts it waits for the
+// server's Retry-After when present and a jittered exponential backoff
+// otherwise.
+func (r *retryPolicy) do(ctx context.Context, operation string, fn func() error) error {
+	return r.run(ctx, operation, isRetryable, fn)
+}
+
+// doPost is do for requests that are not idempotent. A gateway error may
+// arrive after Cloud DNS accepted the job, and repeating it would create
+// duplicates, so only responses that refused the request are retried.
+func (r *retryPolicy) doPost(ctx context.Context, operation string, fn func() error) error {
+	return r.run(ctx, operation, isRetryablePost, fn)
+}
+
+func (r *retryPolicy) run(ctx context.Context, operation string, retryable func(error) bool, fn func() error) error {
+	attempts := 1
+	if r != nil {
+		attempts = r.maxAttempts
+	}
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = fn(); err == nil || !retryable(err) || attempt >= attempts {
+			return err
+		}
+		delay := r.delay(attempt, err)
+		logging.FromContext(ctx).Warn("Retrying Cloud DNS call", "operation", operation, "attempt", attempt, "delay", delay, "error", err)
+		select {
+		case <-ctx.Done():
+			return errors.Join(err, ctx.Err())
+		case <-time.After(delay):
+		}
+	}
+}
+
+// delay returns how long to wait before the attempt following attempt. A
+// Retry-After longer than maxDelay is cut short so a bad header cannot hold
+// up ApplyChanges.
+func (r *retryPolicy) delay(attempt int, err error) time.Duration {
+	if retryAfter, ok := retryAfterFrom(err); ok {
+		return min(retryAfter, r.maxDelay)
+	}
+	backoff := r.baseDelay << (attempt - 1)
+	if backoff <= 0 || backoff > r.maxDelay {
+		backoff = r.maxDelay
+	}
+	// Full jitter keeps sidecars that were throttled together from retrying in lockstep.
+	return time.Duration(rand.Int64N(int64(backoff) + 1))
+}
+
+// isRetryable reports whether err is a throttling or transient availability
+// response from Cloud DNS. Cloud DNS reports rate limiting as 413 "over limit".
+func isRetryable(err error) bool {
+	var codeErr gophercloud.ErrUnexpectedResponseCode
+	if !errors.As(err, &codeErr) {
+		return false
+	}
+	switch codeErr.Actual {
+	case http.StatusRequestEntityTooLarge, http.StatusTooManyRequests,
+		http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// isRetryablePost reports whether err shows Cloud DNS turned a request away
+// without acting on it: throttling, or the service being unavailable.
+func isRetryablePost(err error) bool {
+	var codeErr gophercloud.ErrUnexpectedResponseCode
+	if !errors.As(err, &codeErr) {
+		return false
+	}
+	switch codeErr.Actual {
+	case http.StatusRequestEntityTooLarge, http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		return true
+	}
+	return false
+}
+
+// retryAfterFrom extracts the Retry-After header, in seconds or as an HTTP date.
+func retryAfterFrom(err error) (time.Duration, bool) {
+	var codeErr gophercloud.ErrUnexpectedResponseCode
+	if !errors.As(err, &codeErr) || codeErr.ResponseHeader == nil {
+		return 0, false
+	}
+	value := codeErr.ResponseHeader.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return max(time.Until(at), 0), true
+	}
+	return 0, false
+}
+
+// retryingServiceClient retries throttled ServiceClient calls using a
+// retryPolicy. Pagers fetch their pages lazily inside gophercloud, so list
+// calls are passed through unchanged and retried by eachPageWithRetry.
+type retryingServiceClient struct {
+	ServiceClient
+	policy *retryPolicy
+}
+
+func newRetryingServiceClient(next ServiceClient, policy *retryPolicy) ServiceClient {
+	return &retryingServiceClient{ServiceClient: next, policy: policy}
+}
+
+func (r *retryingServiceClient) CreateRecord(ctx context.Context, domainID string, opts records.CreateOpts) (*records.RecordList, error) {
+	var created *records.RecordList
+	err := r.policy.doPost(ctx, "create_record", func() (err error) {
+		created, err = r.ServiceClient.CreateRecord(ctx, domainID, opts)
+		return err
+	})
+	return created, err
+}
+
+func (r *retryingServiceClient) CreateRecords(ctx context.Context, domainID string, opts []records.CreateOpts) ([]records.RecordList, error) {
+	var created []records.RecordList
+	err := r.policy.doPost(ctx, "create_records", func() (err error) {
+		created, err = r.ServiceClient.CreateRecords(ctx, domainID, opts)
+		return err
+	})
+	return created, err
+}
+
+func (r *retryingServiceClient) CreateDomain(ctx context.Context, opts domains.CreateOpts) (*domains.DomainList, error) {
+	var created *domains.DomainList
+	err := r.policy.doPost(ctx, "create_domain", func() (err error) {
+		created, err = r.ServiceClient.CreateDomain(ctx, opts)
+		return err
+	})
+	return created, err
+}
+
+func (r *retryingServiceClient) ListPTRRecords(ctx context.Context, service, href string) ([]records.RecordList, error) {
+	var ptrs []records.RecordList
+	err := r.policy.do(ctx, "list_rdns", func() (err error) {
+		ptrs, err = r.ServiceClient.ListPTRRecords(ctx, service, href)
+		return err
+	})
+	return ptrs, err
+}
+
+func (r *retryingServiceClient) AddPTRRecords(ctx context.Context, service, href string, opts []records.CreateOpts) error {
+	return r.policy.doPost(ctx, "create_rdns", func() error {
+		return r.ServiceClient.AddPTRRecords(ctx, service, href, opts)
+	})
+}
+
+func (r *retryingServiceClient) DeletePTRRecord(ctx context.Context, service, href, ip string) error {
+	return r.policy.do(ctx, "delete_rdns", func() error {
+		return r.ServiceClient.DeletePTRRecord(ctx, service, href, ip)
+	})
+}
+
+func (r *retryingServiceClient) UpdateRecord(ctx context.Context, domainID, recordID string, opts records.UpdateOpts) error {
+	return r.policy.do(ctx, "update_record", func() error {
+		return r.ServiceClient.UpdateRecord(ctx, domainID, recordID, opts)
+	})
+}
+
+func (r *retryingServiceClient) DeleteRecord(ctx context.Context, domainID, recordID string) error {
+	return r.policy.do(ctx, "delete_record", func() error {
+		return r.ServiceClient.DeleteRecord(ctx, domainID, recordID)
+	})
+}
+
+func (r *retryingServiceClient) DeleteRecords(ctx context.Context, domainID string, recordIDs []string) error {
+	return r.policy.do(ctx, "delete_records", func() error {
+		return r.ServiceClient.DeleteRecords(ctx, domainID, recordIDs)
+	})
+}
+
+// eachPageWithRetry walks a listing from the first page, starting over when
+// a page fails with a retryable error. reset is called before every attempt
+// so the caller can discard pages collected by the failed attempt. Every page
+// after the first waits on the list rate limiter before it is fetched. Each
+// page is recorded as an event on the caller's span, tagged with its attempt.
+func (p *RackspaceProvider) eachPageWithRetry(ctx context.Context, operation string, list func(ServiceClient) pagination.Pager, reset func(), handler func(context.Context, pagination.Page) (bool, error)) error {
+	span := trace.SpanFromContext(ctx)
+	attempt, pages := 0, 0
+	paced := func(ctx context.Context, page pagination.Page) (bool, error) {
+		pages++
+		span.AddEvent("page", trace.WithAttributes(attribute.Int("page", pages), attribute.Int("attempt", attempt)))
+		more, err := handler(ctx, page)
+		if err != nil || !more {
+			return more, err
+		}
+		if next, _ := page.NextPageURL(); next != "" {
+			if err := p.limiter.wait(ctx, classList); err != nil {
+				return false, err
+			}
+		}
+		return true, nil
+	}
+	return p.retry.do(ctx, operation, func() error {
+		attempt++
+		pages = 0
+		reset()
+		return list(p.getClient(ctx)).EachPage(ctx, paced)
+	})
+}
@@ -0,0 +1,187 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/rackerlabs/goclouddns/records"
+
+	th "github.com/gophercloud/gophercloud/v2/testhelper"
+)
+
+func fastRetryPolicy(maxAttempts int) *retryPolicy {
+	return &retryPolicy{maxAttempts: maxAttempts, baseDelay: time.Millisecond, maxDelay: 5 * time.Millisecond}
+}
+
+// throttlingHandler fails the first n requests with status and then serves ok.
+func throttlingHandler(n int, status int, retryAfter string, calls *int, ok http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		*calls++
+		if *calls <= n {
+			if retryAfter != "" {
+				w.Header().Set("Retry-After", retryAfter)
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(status)
+			_, _ = fmt.Fprintf(w, `{"overLimit":{"code":%d,"message":"OverLimit Retry..."}}`, status)
+			return
+		}
+		ok(w, r)
+	}
+}
+
+func TestRetryingServiceClient(t *testing.T) {
+	tests := []struct {
+		name        string
+		failures    int
+		status      int
+		retryAfter  string
+		maxAttempts int
+		wantCalls   int
+		wantErr     bool
+	}{
+		{name: "413 over limit then success", failures: 2, status: http.StatusRequestEntityTooLarge, retryAfter: "0", maxAttempts: 5, wantCalls: 3},
+		{name: "429 then success", failures: 1, status: http.StatusTooManyRequests, maxAttempts: 5, wantCalls: 2},
+		{name: "503 exhausts attempts", failures: 10, status: http.StatusServiceUnavailable, maxAttempts: 3, wantCalls: 3, wantErr: true},
+		{name: "400 is not retried", failures: 1, status: http.StatusBadRequest, maxAttempts: 5, wantCalls: 1, wantErr: true},
+		// The create may have been accepted behind the gateway.
+		{name: "502 is not retried for a create", failures: 1, status: http.StatusBadGateway, maxAttempts: 5, wantCalls: 1, wantErr: true},
+		{name: "504 is not retried for a create", failures: 1, status: http.StatusGatewayTimeout, maxAttempts: 5, wantCalls: 1, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakeServer := th.SetupHTTP()
+			defer fakeServer.Teardown()
+
+			calls := 0
+			fakeServer.Mux.HandleFunc("/domains/111/records", throttlingHandler(tt.failures, tt.status, tt.retryAfter, &calls, func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusAccepted)
+				_, _ = fmt.Fprint(w, `{"status":"COMPLETED","response":{"records":[{"id":"r1","name":"a.example.com"}]}}`)
+			}))
+
+			client := newRetryingServiceClient(NewRackspaceDNSClient(FakeDNSClient(fakeServer.Endpoint())), fastRetryPolicy(tt.maxAttempts))
+			created, err := client.CreateRecords(context.Background(), "111", []records.CreateOpts{{Name: "a.example.com", Type: "A", Data: "10.0.0.1"}})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CreateRecords() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("expected %d calls, got %d", tt.wantCalls, calls)
+			}
+			if !tt.wantErr && (len(created) != 1 || created[0].ID != "r1") {
+				t.Errorf("unexpected created records: %+v", created)
+			}
+		})
+	}
+}
+
+func TestRetryingServiceClient_HonoursContextCancellation(t *testing.T) {
+	fakeServer := th.SetupHTTP()
+	defer fakeServer.Teardown()
+
+	calls := 0
+	fakeServer.Mux.HandleFunc("/domains/111/records/r1", throttlingHandler(100, http.StatusRequestEntityTooLarge, "60", &calls, nil))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	// Allow the full Retry-After so the wait outlasts the context.
+	policy := &retryPolicy{maxAttempts: 5, baseDelay: time.Millisecond, maxDelay: time.Minute}
+	client := newRetryingServiceClient(NewRackspaceDNSClient(FakeDNSClient(fakeServer.Endpoint())), policy)
+	start := time.Now()
+	err := client.DeleteRecord(ctx, "111", "r1")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected context deadline error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("retry ignored cancellation and waited %s", elapsed)
+	}
+	if calls != 1 {
+		t.Errorf("expected a single attempt before cancellation, got %d", calls)
+	}
+}
+
+func TestRecords_RetriesThrottledListing(t *testing.T) {
+	fakeServer := th.SetupHTTP()
+	defer fakeServer.Teardown()
+
+	domainCalls, recordCalls := 0, 0
+	fakeServer.Mux.HandleFunc("/domains", throttlingHandler(1, http.StatusServiceUnavailable, "", &domainCalls, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprint(w, `{"domains":[{"id":"111","name":"example.com"}]}`)
+	}))
+	fakeServer.Mux.HandleFunc("/domains/111/records", throttlingHandler(2, http.StatusRequestEntityTooLarge, "0", &recordCalls, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprint(w, `{"records":[{"id":"r1","name":"a.example.com","type":"A","data":"10.0.0.1","ttl":300}]}`)
+	}))
+
+	p := newTestProvider(t, fakeServer.Endpoint())
+	p.retry = fastRetryPolicy(5)
+
+	eps, err := p.Records(context.Background())
+	if err != nil {
+		t.Fatalf("Records() error: %v", err)
+	}
+	if len(eps) != 1 || len(eps[0].Targets) != 1 {
+		t.Errorf("expected one endpoint with one target after retries, got %+v", eps)
+	}
+	if domainCalls != 2 || recordCalls != 3 {
+		t.Errorf("expected 2 domain and 3 record list calls, got %d and %d", domainCalls, recordCalls)
+	}
+}
+
+func TestRetryAfterFrom(t *testing.T) {
+	fakeServer := th.SetupHTTP()
+	defer fakeServer.Teardown()
+
+	calls := 0
+	fakeServer.Mux.HandleFunc("/domains/111/records/r1", throttlingHandler(1, http.StatusRequestEntityTooLarge, "7", &calls, nil))
+
+	err := NewRackspaceDNSClient(FakeDNSClient(fakeServer.Endpoint())).DeleteRecord(context.Background(), "111", "r1")
+	delay, ok := retryAfterFrom(err)
+	if !ok || delay != 7*time.Second {
+		t.Errorf("retryAfterFrom() = %s, %v; want 7s, true", delay, ok)
+	}
+	if !isRetryable(err) {
+		t.Errorf("expected 413 to be retryable: %v", err)
+	}
+}
+
+func TestRetryingServiceClient_RetriesGatewayErrorsForDeletes(t *testing.T) {
+	fakeServer := th.SetupHTTP()
+	defer fakeServer.Teardown()
+
+	calls := 0
+	fakeServer.Mux.HandleFunc("/domains/111/records/r1", throttlingHandler(1, http.StatusBadGateway, "", &calls, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		_, _ = fmt.Fprint(w, `{"status":"COMPLETED"}`)
+	}))
+
+	client := newRetryingServiceClient(NewRackspaceDNSClient(FakeDNSClient(fakeServer.Endpoint())), fastRetryPolicy(5))
+	if err := client.DeleteRecord(context.Background(), "111", "r1"); err != nil {
+		t.Fatalf("DeleteRecord() error: %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("expected the delete to be retried once, got %d calls", calls)
+	}
+}
+
+func TestRetryPolicy_CapsRetryAfter(t *testing.T) {
+	fakeServer := th.SetupHTTP()
+	defer fakeServer.Teardown()
+
+	calls := 0
+	fakeServer.Mux.HandleFunc("/domains/111/records/r1", throttlingHandler(1, http.StatusRequestEntityTooLarge, "86400", &calls, nil))
+
+	err := NewRackspaceDNSClient(FakeDNSClient(fakeServer.Endpoint())).DeleteRecord(context.Background(), "111", "r1")
+	policy := newRetryPolicy(3)
+	if delay := policy.delay(1, err); delay != policy.maxDelay {
+		t.Errorf("delay() = %s, want it capped at %s", delay, policy.maxDelay)
+	}
+}
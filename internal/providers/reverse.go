@@ -0,0 +1,184 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/rackerlabs/goclouddns/domains"
+	"github.com/rackerlabs/goclouddns/records"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+
+	"github.com/rackerlabs/external-dns-rackspace-webhook/internal/logging"
+)
+
+// ptrComment marks the PTR records kept in step with A and AAAA endpoints.
+// Only records carrying it are removed, and they are not reported to
+// external-dns.
+const ptrComment = "PTR managed by external-dns-rackspace-webhook"
+
+func (p *RackspaceProvider) ptrRecordsEnabled() bool {
+	return p.config != nil && p.config.ManagePTRRecords
+}
+
+// reverseName returns the in-addr.arpa or ip6.arpa name of an address.
+func reverseName(address string) (string, bool) {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return "", false
+	}
+	if v4 := ip.To4(); v4 != nil {
+		return fmt.Sprintf("%d.%d.%d.%d.in-addr.arpa", v4[3], v4[2], v4[1], v4[0]), true
+	}
+	var b strings.Builder
+	for i := len(ip) - 1; i >= 0; i-- {
+		b.WriteString(strconv.FormatUint(uint64(ip[i]&0x0f), 16))
+		b.WriteByte('.')
+		b.WriteString(strconv.FormatUint(uint64(ip[i]>>4), 16))
+		b.WriteByte('.')
+	}
+	b.WriteString("ip6.arpa")
+	return b.String(), true
+}
+
+// reverseRecord is the PTR record one A or AAAA target calls for.
+type reverseRecord struct {
+	name   string
+	target string
+	ttl    uint
+}
+
+// collectReverseRecords gathers the PTR records for the targets of the A
+// and AAAA endpoints in eps.
+func collectReverseRecords(eps []*endpoint.Endpoint, into map[reverseRecord]bool) {
+	for _, ep := range eps {
+		if ep.RecordType != endpoint.RecordTypeA && ep.RecordType != endpoint.RecordTypeAAAA {
+			continue
+		}
+		var ttl uint
+		if ep.RecordTTL.IsConfigured() {
+			ttl = uint(ep.RecordTTL)
+		}
+		for _, target := range ep.Targets {
+			if name, ok := reverseName(target); ok {
+				into[reverseRecord{name: name, target: normalizeDomain(ep.DNSName), ttl: ttl}] = true
+			}
+		}
+	}
+}
+
+// applyReverseZones keeps PTR records in hosted reverse zones in step with
+// the A and AAAA records in changes. Addresses without a managed reverse
+// zone are skipped, and an address never gets more than one PTR record. It
+// runs after the forward records are written.
+func (p *RackspaceProvider) applyReverseZones(ctx context.Context, changes *plan.Changes) error {
+	previous := map[reverseRecord]bool{}
+	collectReverseRecords(changes.Delete, previous)
+	collectReverseRecords(changes.UpdateOld, previous)
+	desired := map[reverseRecord]bool{}
+	collectReverseRecords(changes.Create, desired)
+	collectReverseRecords(changes.UpdateNew, desired)
+
+	// A TTL change alone leaves the PTR record in place.
+	wanted := map[reverseRecord]bool{}
+	for rec := range desired {
+		wanted[reverseRecord{name: rec.name, target: rec.target}] = true
+	}
+
+	type zoneChanges struct {
+		domain *domains.DomainList
+		create []records.CreateOpts
+		delete []records.RecordList
+	}
+	var order []string
+	byZone := map[string]*zoneChanges{}
+	var errs []error
+	// lookup returns the PTR records at rec.name in its reverse zone, or a
+	// nil zone when the address has no managed reverse zone.
+	lookup := func(rec reverseRecord) (*zoneChanges, []records.RecordList) {
+		if !p.DomainFilter.Match(rec.name) {
+			return nil, nil
+		}
+		domain, err := p.findDomain(ctx, rec.name)
+		if errors.Is(err, errNoMatchingDomain) {
+			logging.FromContext(ctx).Debug("No reverse zone for address", "name", rec.name, "target", rec.target)
+			return nil, nil
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to find reverse zone for %s: %w", rec.name, err))
+			return nil, nil
+		}
+		existing, err := p.listRecordsByName(ctx, domain, rec.name, "PTR")
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to list PTR records for %s: %w", rec.name, err))
+			return nil, nil
+		}
+		zone, ok := byZone[domain.ID]
+		if !ok {
+			zone = &zoneChanges{domain: domain}
+			byZone[domain.ID] = zone
+			order = append(order, domain.ID)
+		}
+		return zone, existing
+	}
+
+	deleting := map[string]bool{}
+	for rec := range previous {
+		if wanted[reverseRecord{name: rec.name, target: rec.target}] {
+			continue
+		}
+		zone, existing := lookup(rec)
+		for _, ptr := range existing {
+			// Records differing only in TTL find the same PTR record.
+			if ptr.Comment == ptrComment && normalizeDomain(ptr.Data) == rec.target && !deleting[ptr.ID] {
+				zone.delete = append(zone.delete, ptr)
+				deleting[ptr.ID] = true
+			}
+		}
+	}
+
+	// Several names may point at one address, such as hosts behind a load
+	// balancer. Resolvers return multiple PTR records in random order, so
+	// the reverse name gets one record, owned by the first name in sort
+	// order, and only while it has none.
+	owners := map[string]reverseRecord{}
+	for rec := range desired {
+		if owner, ok := owners[rec.name]; !ok || rec.target < owner.target {
+			owners[rec.name] = rec
+		}
+	}
+	for _, rec := range owners {
+		zone, existing := lookup(rec)
+		if zone == nil {
+			continue
+		}
+		taken := false
+		for _, ptr := range existing {
+			taken = taken || !deleting[ptr.ID]
+		}
+		if !taken {
+			zone.create = append(zone.create, records.CreateOpts{
+				Name:    rec.name,
+				Type:    "PTR",
+				Data:    rec.target,
+				TTL:     rec.ttl,
+				Comment: ptrComment,
+			})
+		}
+	}
+
+	for _, id := range order {
+		zone := byZone[id]
+		if err := p.deleteInDomain(ctx, zone.domain, zone.delete); err != nil {
+			errs = append(errs, fmt.Errorf("failed to remove PTR records from %s: %w", zone.domain.Name, err))
+		}
+		if err := p.createInDomain(ctx, zone.domain, zone.create); err != nil {
+			errs = append(errs, fmt.Errorf("failed to add PTR records to %s: %w", zone.domain.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
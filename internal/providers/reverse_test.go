@@ -0,0 +1,308 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	th "github.com/gophercloud/gophercloud/v2/testhelper"
+	"github.com/rackerlabs/goclouddns/records"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+func TestReverseName(t *testing.T) {
+	tests := []struct {
+		address string
+		want    string
+		wantOK  bool
+	}{
+		{address: "10.1.2.3", want: "3.2.1.10.in-addr.arpa", wantOK: true},
+		{address: "2001:db8::1", want: "1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa", wantOK: true},
+		{address: "www.example.com"},
+	}
+	for _, tt := range tests {
+		got, ok := reverseName(tt.address)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("reverseName(%q) = %q, %v; want %q, %v", tt.address, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestApplyChanges_ManagesPTRRecords(t *testing.T) {
+	fakeServer := th.SetupHTTP()
+	defer fakeServer.Teardown()
+
+	var mu sync.Mutex
+	var created []records.CreateOpts
+	var deleted []string
+
+	fakeServer.Mux.HandleFunc("/domains", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprint(w, `{"domains":[
+			{"id":"111","name":"example.com"},
+			{"id":"222","name":"10.in-addr.arpa"},
+			{"id":"333","name":"1.10.in-addr.arpa"},
+			{"id":"444","name":"192.in-addr.arpa"}
+		]}`)
+	})
+	fakeServer.Mux.HandleFunc("/domains/111/records", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.Method {
+		case http.MethodGet:
+			_, _ = fmt.Fprint(w, `{"records":[{"id":"r1","name":"old.example.com","type":"A","data":"10.1.0.9","ttl":300}]}`)
+		case http.MethodPost:
+			w.WriteHeader(http.StatusAccepted)
+			_, _ = fmt.Fprint(w, `{"status":"COMPLETED","response":{"records":[{"id":"r2"}]}}`)
+		case http.MethodDelete:
+			w.WriteHeader(http.StatusAccepted)
+			_, _ = fmt.Fprint(w, `{"status":"COMPLETED"}`)
+		}
+	})
+	fakeServer.Mux.HandleFunc("/domains/333/records", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		switch r.Method {
+		case http.MethodGet:
+			_, _ = fmt.Fprint(w, `{"records":[
+				{"id":"p1","name":"9.0.1.10.in-addr.arpa","type":"PTR","data":"old.example.com","ttl":300,"comment":"`+ptrComment+`"},
+				{"id":"p2","name":"9.0.1.10.in-addr.arpa","type":"PTR","data":"old.example.com","ttl":300},
+				{"id":"p3","name":"7.0.1.10.in-addr.arpa","type":"PTR","data":"www.example.com","ttl":300}
+			]}`)
+		case http.MethodPost:
+			var payload struct {
+				Records []records.CreateOpts `json:"records"`
+			}
+			_ = json.NewDecoder(r.Body).Decode(&payload)
+			created = append(created, payload.Records...)
+			w.WriteHeader(http.StatusAccepted)
+			_, _ = fmt.Fprint(w, `{"status":"COMPLETED","response":{"records":[{"id":"p9"}]}}`)
+		case http.MethodDelete:
+			deleted = append(deleted, r.URL.Query()["id"]...)
+			w.WriteHeader(http.StatusAccepted)
+			_, _ = fmt.Fprint(w, `{"status":"COMPLETED"}`)
+		}
+	})
+	for _, path := range []string{"/domains/222/records", "/domains/444/records"} {
+		fakeServer.Mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		})
+	}
+
+	p := newTestProvider(t, fakeServer.Endpoint())
+	p.config.DomainFilter = []string{"example.com", "10.in-addr.arpa"}
+	p.config.ManagePTRRecords = true
+	p.DomainFilter = newDomainFilter(p.config)
+
+	changes := &plan.Changes{
+		Create: []*endpoint.Endpoint{
+			endpoint.NewEndpointWithTTL("www.example.com", endpoint.RecordTypeA, 600, "10.1.0.1", "10.1.0.7", "192.168.0.1", "172.16.0.1"),
+		},
+		Delete: []*endpoint.Endpoint{
+			endpoint.NewEndpoint("old.example.com", endpoint.RecordTypeA, "10.1.0.9"),
+		},
+	}
+	if err := p.ApplyChanges(context.Background(), changes); err != nil {
+		t.Fatalf("ApplyChanges() error: %v", err)
+	}
+
+	if len(created) != 1 {
+		t.Fatalf("expected one PTR record in 1.10.in-addr.arpa, got %+v", created)
+	}
+	if got := created[0]; got.Name != "1.0.1.10.in-addr.arpa" || got.Type != "PTR" || got.Data != "www.example.com" || got.TTL != 600 || got.Comment != ptrComment {
+		t.Errorf("unexpected PTR record: %+v", got)
+	}
+	if len(deleted) != 1 || deleted[0] != "p1" {
+		t.Errorf("expected only the managed PTR record of old.example.com to be removed, got %v", deleted)
+	}
+}
+
+func TestConvertRecordToEndpoint_HidesManagedPTR(t *testing.T) {
+	managed := records.RecordList{Name: "1.0.1.10.in-addr.arpa", Type: "PTR", Data: "www.example.com", Comment: ptrComment}
+	if ep := convertRecordToEndpoint(context.Background(), managed, "10.in-addr.arpa"); ep != nil {
+		t.Errorf("expected managed PTR record to be hidden, got %v", ep)
+	}
+	manual := records.RecordList{Name: "2.0.1.10.in-addr.arpa", Type: "PTR", Data: "mail.example.com"}
+	if ep := convertRecordToEndpoint(context.Background(), manual, "10.in-addr.arpa"); ep == nil {
+		t.Error("expected other PTR records to be returned")
+	}
+}
+
+func TestApplyChanges_OnePTRPerAddress(t *testing.T) {
+	fakeServer := th.SetupHTTP()
+	defer fakeServer.Teardown()
+
+	var mu sync.Mutex
+	var created []records.CreateOpts
+
+	fakeServer.Mux.HandleFunc("/domains", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprint(w, `{"domains":[{"id":"111","name":"example.com"},{"id":"222","name":"10.in-addr.arpa"}]}`)
+	})
+	fakeServer.Mux.HandleFunc("/domains/111/records", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == http.MethodPost {
+			w.WriteHeader(http.StatusAccepted)
+			_, _ = fmt.Fprint(w, `{"status":"COMPLETED","response":{"records":[{"id":"r1"}]}}`)
+			return
+		}
+		_, _ = fmt.Fprint(w, `{"records":[]}`)
+	})
+	fakeServer.Mux.HandleFunc("/domains/222/records", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		switch r.Method {
+		case http.MethodGet:
+			// 10.0.0.6 already has a PTR record, added by hand.
+			_, _ = fmt.Fprint(w, `{"records":[{"id":"p1","name":"6.0.0.10.in-addr.arpa","type":"PTR","data":"lb.example.com","ttl":300}]}`)
+		case http.MethodPost:
+			var payload struct {
+				Records []records.CreateOpts `json:"records"`
+			}
+			_ = json.NewDecoder(r.Body).Decode(&payload)
+			created = append(created, payload.Records...)
+			w.WriteHeader(http.StatusAccepted)
+			_, _ = fmt.Fprint(w, `{"status":"COMPLETED","response":{"records":[{"id":"p9"}]}}`)
+		}
+	})
+
+	p := newTestProvider(t, fakeServer.Endpoint())
+	p.config.DomainFilter = []string{"example.com", "10.in-addr.arpa"}
+	p.config.ManagePTRRecords = true
+	p.DomainFilter = newDomainFilter(p.config)
+
+	// Both hosts sit behind the same two load balancer addresses.
+	changes := &plan.Changes{Create: []*endpoint.Endpoint{
+		endpoint.NewEndpoint("web.example.com", endpoint.RecordTypeA, "10.0.0.5", "10.0.0.6"),
+		endpoint.NewEndpoint("api.example.com", endpoint.RecordTypeA, "10.0.0.5", "10.0.0.6"),
+	}}
+	if err := p.ApplyChanges(context.Background(), changes); err != nil {
+		t.Fatalf("ApplyChanges() error: %v", err)
+	}
+
+	if len(created) != 1 {
+		t.Fatalf("expected a single PTR record for the shared address, got %+v", created)
+	}
+	if got := created[0]; got.Name != "5.0.0.10.in-addr.arpa" || got.Data != "api.example.com" {
+		t.Errorf("expected api.example.com to own the PTR record as the first name in sort order, got %+v", got)
+	}
+}
+
+func TestApplyChanges_ReverseZonesSeeEarlierWrites(t *testing.T) {
+	fakeServer := th.SetupHTTP()
+	defer fakeServer.Teardown()
+
+	var mu sync.Mutex
+	var ptrs []string
+	var created []records.CreateOpts
+	fakeServer.Mux.HandleFunc("/domains", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprint(w, `{"domains":[{"id":"111","name":"example.com"},{"id":"222","name":"10.in-addr.arpa"}]}`)
+	})
+	fakeServer.Mux.HandleFunc("/domains/111/records", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == http.MethodPost {
+			w.WriteHeader(http.StatusAccepted)
+			_, _ = fmt.Fprint(w, `{"status":"COMPLETED","response":{"records":[{"id":"r1"}]}}`)
+			return
+		}
+		_, _ = fmt.Fprint(w, `{"records":[]}`)
+	})
+	fakeServer.Mux.HandleFunc("/domains/222/records", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		switch r.Method {
+		case http.MethodGet:
+			_, _ = fmt.Fprintf(w, `{"records":[%s]}`, strings.Join(ptrs, ","))
+		case http.MethodPost:
+			var payload struct {
+				Records []records.CreateOpts `json:"records"`
+			}
+			_ = json.NewDecoder(r.Body).Decode(&payload)
+			for _, rec := range payload.Records {
+				created = append(created, rec)
+				ptrs = append(ptrs, fmt.Sprintf(`{"id":"p%d","name":%q,"type":"PTR","data":%q,"ttl":300}`, len(ptrs)+1, rec.Name, rec.Data))
+			}
+			w.WriteHeader(http.StatusAccepted)
+			_, _ = fmt.Fprint(w, `{"status":"COMPLETED","response":{"records":[]}}`)
+		}
+	})
+
+	p := newTestProvider(t, fakeServer.Endpoint())
+	p.cache = newZoneCache(time.Minute)
+	p.config.DomainFilter = []string{"example.com", "10.in-addr.arpa"}
+	p.config.ManagePTRRecords = true
+	p.DomainFilter = newDomainFilter(p.config)
+	// Records fills the cache with the reverse zone as it was before.
+	if _, err := p.Records(context.Background()); err != nil {
+		t.Fatalf("Records() error: %v", err)
+	}
+
+	// The same plan writes a PTR record of its own for the address.
+	changes := &plan.Changes{Create: []*endpoint.Endpoint{
+		endpoint.NewEndpoint("5.0.0.10.in-addr.arpa", "PTR", "lb.example.com"),
+		endpoint.NewEndpoint("web.example.com", endpoint.RecordTypeA, "10.0.0.5"),
+	}}
+	if err := p.ApplyChanges(context.Background(), changes); err != nil {
+		t.Fatalf("ApplyChanges() error: %v", err)
+	}
+	if len(created) != 1 || created[0].Data != "lb.example.com" {
+		t.Errorf("expected only the planned PTR record, got %+v", created)
+	}
+}
+
+func TestApplyChanges_DeletesPTRRecordOnce(t *testing.T) {
+	fakeServer := th.SetupHTTP()
+	defer fakeServer.Teardown()
+
+	var deleted []string
+	fakeServer.Mux.HandleFunc("/domains", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprint(w, `{"domains":[{"id":"111","name":"example.com"},{"id":"222","name":"10.in-addr.arpa"}]}`)
+	})
+	fakeServer.Mux.HandleFunc("/domains/111/records", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == http.MethodDelete {
+			w.WriteHeader(http.StatusAccepted)
+			_, _ = fmt.Fprint(w, `{"status":"COMPLETED"}`)
+			return
+		}
+		_, _ = fmt.Fprint(w, `{"records":[{"id":"r1","name":"old.example.com","type":"A","data":"10.0.0.9","ttl":300}]}`)
+	})
+	fakeServer.Mux.HandleFunc("/domains/222/records", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.Method {
+		case http.MethodGet:
+			_, _ = fmt.Fprint(w, `{"records":[{"id":"p1","name":"9.0.0.10.in-addr.arpa","type":"PTR","data":"old.example.com","ttl":300,"comment":"`+ptrComment+`"}]}`)
+		case http.MethodDelete:
+			deleted = append(deleted, r.URL.Query()["id"]...)
+			w.WriteHeader(http.StatusAccepted)
+			_, _ = fmt.Fprint(w, `{"status":"COMPLETED"}`)
+		}
+	})
+
+	p := newTestProvider(t, fakeServer.Endpoint())
+	p.config.DomainFilter = []string{"example.com", "10.in-addr.arpa"}
+	p.config.ManagePTRRecords = true
+	p.DomainFilter = newDomainFilter(p.config)
+
+	// Two endpoints differing only in TTL lead to the same PTR record.
+	changes := &plan.Changes{Delete: []*endpoint.Endpoint{
+		endpoint.NewEndpointWithTTL("old.example.com", endpoint.RecordTypeA, 300, "10.0.0.9"),
+		endpoint.NewEndpointWithTTL("old.example.com", endpoint.RecordTypeA, 600, "10.0.0.9"),
+	}}
+	if err := p.ApplyChanges(context.Background(), changes); err != nil {
+		t.Fatalf("ApplyChanges() error: %v", err)
+	}
+	if len(deleted) != 1 || deleted[0] != "p1" {
+		t.Errorf("expected the PTR record to be deleted once, got %v", deleted)
+	}
+}
@@ -2,9 +2,14 @@ package providers
 
 import (
 	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
 
 	"github.com/gophercloud/gophercloud/v2"
 	"github.com/gophercloud/gophercloud/v2/pagination"
+	"github.com/rackerlabs/goclouddns"
 	"github.com/rackerlabs/goclouddns/domains"
 	"github.com/rackerlabs/goclouddns/records"
 )
@@ -14,16 +19,34 @@ type ServiceClient interface {
 	ListDomains(ctx context.Context, opts domains.ListOpts) pagination.Pager
 	ListRecords(ctx context.Context, domainID string, opts records.ListOpts) pagination.Pager
 	CreateRecord(ctx context.Context, domainID string, opts records.CreateOpts) (*records.RecordList, error)
+	CreateRecords(ctx context.Context, domainID string, opts []records.CreateOpts) ([]records.RecordList, error)
+	UpdateRecord(ctx context.Context, domainID, recordID string, opts records.UpdateOpts) error
 	DeleteRecord(ctx context.Context, domainID, recordID string) error
+	DeleteRecords(ctx context.Context, domainID string, recordIDs []string) error
+	GetLimits(ctx context.Context) (*AccountLimits, error)
+	CreateDomain(ctx context.Context, opts domains.CreateOpts) (*domains.DomainList, error)
+	ListPTRRecords(ctx context.Context, service, href string) ([]records.RecordList, error)
+	AddPTRRecords(ctx context.Context, service, href string, opts []records.CreateOpts) error
+	DeletePTRRecord(ctx context.Context, service, href, ip string) error
 }
 
 // RackspaceDNSClient implements DNSClient interface
 type RackspaceDNSClient struct {
-	client *gophercloud.ServiceClient
+	client     *gophercloud.ServiceClient
+	jobTimeout time.Duration
 }
 
 func NewRackspaceDNSClient(client *gophercloud.ServiceClient) *RackspaceDNSClient {
-	return &RackspaceDNSClient{client: client}
+	return &RackspaceDNSClient{client: client, jobTimeout: defaultJobTimeout}
+}
+
+// WithJobTimeout bounds how long write calls wait for their async job to
+// finish. Non-positive values keep the default.
+func (r *RackspaceDNSClient) WithJobTimeout(timeout time.Duration) *RackspaceDNSClient {
+	if timeout > 0 {
+		r.jobTimeout = timeout
+	}
+	return r
 }
 
 func (r *RackspaceDNSClient) ListDomains(ctx context.Context, opts domains.ListOpts) pagination.Pager {
@@ -35,9 +58,185 @@ func (r *RackspaceDNSClient) ListRecords(ctx context.Context, domainID string, o
 }
 
 func (r *RackspaceDNSClient) CreateRecord(ctx context.Context, domainID string, opts records.CreateOpts) (*records.RecordList, error) {
-	return records.Create(ctx, r.client, domainID, opts).Extract()
+	created, err := r.CreateRecords(ctx, domainID, []records.CreateOpts{opts})
+	if err != nil {
+		return nil, err
+	}
+	if len(created) == 0 {
+		return &records.RecordList{}, nil
+	}
+	return &created[0], nil
+}
+
+// CreateRecords creates several records in one domain with a single request.
+// Callers are responsible for keeping len(opts) within maxRecordsPerRequest.
+func (r *RackspaceDNSClient) CreateRecords(ctx context.Context, domainID string, opts []records.CreateOpts) ([]records.RecordList, error) {
+	endpoint := r.client.ServiceURL("domains", domainID, "records")
+	body := struct {
+		Records []recordBody `json:"records"`
+	}{make([]recordBody, 0, len(opts))}
+	for _, o := range opts {
+		body.Records = append(body.Records, newRecordBody(o))
+	}
+
+	var resp goclouddns.AsyncResult
+	if _, resp.Err = r.client.Post(ctx, endpoint, body, &resp.Body, nil); resp.Err != nil {
+		return nil, resp.Err
+	}
+	if err := r.waitForJob(ctx, &resp); err != nil {
+		return nil, err
+	}
+
+	var s struct {
+		Response struct {
+			Records []records.RecordList `json:"records"`
+		} `json:"response"`
+	}
+	if err := resp.ExtractInto(&s); err != nil {
+		return nil, err
+	}
+	return s.Response.Records, nil
+}
+
+// recordBody is a record as sent to Cloud DNS. MX and SRV records always
+// carry their priority, which CreateOpts would drop when it is 0.
+type recordBody struct {
+	records.CreateOpts
+	Priority *uint `json:"priority,omitempty"`
+}
+
+func newRecordBody(opts records.CreateOpts) recordBody {
+	body := recordBody{CreateOpts: opts}
+	if opts.Type == "MX" || opts.Type == "SRV" {
+		body.Priority = &opts.Priority
+	}
+	return body
+}
+
+// UpdateRecord rewrites a record. The comment is always sent, so an empty
+// one clears it; UpdateOpts alone would leave it out.
+func (r *RackspaceDNSClient) UpdateRecord(ctx context.Context, domainID, recordID string, opts records.UpdateOpts) error {
+	endpoint := r.client.ServiceURL("domains", domainID, "records", recordID)
+	body := struct {
+		records.UpdateOpts
+		Comment string `json:"comment"`
+	}{opts, opts.Comment}
+
+	var resp goclouddns.AsyncResult
+	if _, resp.Err = r.client.Put(ctx, endpoint, body, &resp.Body, nil); resp.Err != nil {
+		return resp.Err
+	}
+	return r.waitForJob(ctx, &resp)
 }
 
 func (r *RackspaceDNSClient) DeleteRecord(ctx context.Context, domainID, recordID string) error {
-	return records.Delete(ctx, r.client, domainID, recordID).ExtractErr()
+	return r.delete(ctx, r.client.ServiceURL("domains", domainID, "records", recordID))
+}
+
+// DeleteRecords deletes several records in one domain with a single request.
+// Callers are responsible for keeping len(recordIDs) within maxRecordsPerRequest.
+func (r *RackspaceDNSClient) DeleteRecords(ctx context.Context, domainID string, recordIDs []string) error {
+	query := url.Values{"id": recordIDs}
+	return r.delete(ctx, r.client.ServiceURL("domains", domainID, "records")+"?"+query.Encode())
+}
+
+func (r *RackspaceDNSClient) delete(ctx context.Context, endpoint string) error {
+	var resp goclouddns.AsyncResult
+	if _, resp.Err = r.client.Delete(ctx, endpoint, &gophercloud.RequestOpts{
+		JSONResponse: &resp.Body,
+	}); resp.Err != nil {
+		return resp.Err
+	}
+	return r.waitForJob(ctx, &resp)
+}
+
+// CreateDomain creates a domain and returns it once its async job completes.
+func (r *RackspaceDNSClient) CreateDomain(ctx context.Context, opts domains.CreateOpts) (*domains.DomainList, error) {
+	body := struct {
+		Domains []domains.CreateOpts `json:"domains"`
+	}{[]domains.CreateOpts{opts}}
+
+	var resp goclouddns.AsyncResult
+	if _, resp.Err = r.client.Post(ctx, r.client.ServiceURL("domains"), body, &resp.Body, nil); resp.Err != nil {
+		return nil, resp.Err
+	}
+	if err := r.waitForJob(ctx, &resp); err != nil {
+		return nil, err
+	}
+
+	var s struct {
+		Response struct {
+			Domains []domains.DomainList `json:"domains"`
+		} `json:"response"`
+	}
+	if err := resp.ExtractInto(&s); err != nil {
+		return nil, err
+	}
+	if len(s.Response.Domains) == 0 {
+		return nil, fmt.Errorf("created domain %s was not returned by Cloud DNS", opts.Name)
+	}
+	return &s.Response.Domains[0], nil
+}
+
+// rdnsURL addresses the PTR records of a device in the rdns API.
+func (r *RackspaceDNSClient) rdnsURL(service, href string, extra url.Values) string {
+	query := url.Values{"href": {href}}
+	for k, v := range extra {
+		query[k] = v
+	}
+	return r.client.ServiceURL("rdns", service) + "?" + query.Encode()
+}
+
+// ListPTRRecords returns the PTR records of a device, which may be none.
+func (r *RackspaceDNSClient) ListPTRRecords(ctx context.Context, service, href string) ([]records.RecordList, error) {
+	var s struct {
+		Records []records.RecordList `json:"records"`
+	}
+	if _, err := r.client.Get(ctx, r.rdnsURL(service, href, nil), &s, nil); err != nil {
+		// The rdns API answers 404 for a device without PTR records.
+		if gophercloud.ResponseCodeIs(err, http.StatusNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return s.Records, nil
+}
+
+// AddPTRRecords creates PTR records for a device in a single request.
+func (r *RackspaceDNSClient) AddPTRRecords(ctx context.Context, service, href string, opts []records.CreateOpts) error {
+	body := struct {
+		RecordsList struct {
+			Records []records.CreateOpts `json:"records"`
+		} `json:"recordsList"`
+		Link struct {
+			Content string `json:"content"`
+			Href    string `json:"href"`
+			Rel     string `json:"rel"`
+		} `json:"link"`
+	}{}
+	body.RecordsList.Records = opts
+	body.Link.Href = href
+	body.Link.Rel = service
+
+	var resp goclouddns.AsyncResult
+	if _, resp.Err = r.client.Post(ctx, r.client.ServiceURL("rdns"), body, &resp.Body, nil); resp.Err != nil {
+		return resp.Err
+	}
+	return r.waitForJob(ctx, &resp)
+}
+
+// DeletePTRRecord removes a device's PTR record for one IP address.
+func (r *RackspaceDNSClient) DeletePTRRecord(ctx context.Context, service, href, ip string) error {
+	return r.delete(ctx, r.rdnsURL(service, href, url.Values{"ip": {ip}}))
+}
+
+// GetLimits reads the account's rate and absolute limits.
+func (r *RackspaceDNSClient) GetLimits(ctx context.Context) (*AccountLimits, error) {
+	var s struct {
+		Limits AccountLimits `json:"limits"`
+	}
+	if _, err := r.client.Get(ctx, r.client.ServiceURL("limits"), &s, nil); err != nil {
+		return nil, err
+	}
+	return &s.Limits, nil
 }
@@ -0,0 +1,170 @@
+package providers
+
+import (
+	"context"
+	"math/rand/v2"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+
+	"github.com/rackerlabs/external-dns-rackspace-webhook/internal/logging"
+	"github.com/rackerlabs/external-dns-rackspace-webhook/internal/metrics"
+)
+
+const (
+	tokenRefreshInitialBackoff = 5 * time.Second
+	tokenRefreshMaxBackoff     = 5 * time.Minute
+)
+
+// tokenRefresh tracks token renewals. last and failures are guarded by
+// RackspaceProvider.mu; group makes concurrent refreshes share one
+// authentication.
+type tokenRefresh struct {
+	group    singleflight.Group
+	last     time.Time
+	failures int
+}
+
+// TokenStatus describes the current token and its renewal, for health checks.
+type TokenStatus struct {
+	ExpiresAt           time.Time `json:"expiresAt"`
+	RefreshAt           time.Time `json:"refreshAt"`
+	LastRefresh         time.Time `json:"lastRefresh,omitzero"`
+	ConsecutiveFailures int       `json:"consecutiveFailures"`
+}
+
+// getClient returns the current ServiceClient. RunTokenRefresher renews the
+// token ahead of expiry, so this only authenticates inline when the token
+// has already expired, and then all callers share a single attempt.
+func (p *RackspaceProvider) getClient(ctx context.Context) ServiceClient {
+	p.mu.RLock()
+	client, expiry := p.serviceClient, p.tokenExpiry
+	p.mu.RUnlock()
+	if time.Now().Before(expiry) {
+		return client
+	}
+
+	if err := p.refreshToken(ctx); err != nil {
+		logging.FromContext(ctx).Error("Token expired and could not be refreshed", "error", err)
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.serviceClient
+}
+
+// credentials identifies the username and API key a token was issued for.
+type credentials struct {
+	username string
+	apiKey   string
+}
+
+// refreshToken authenticates and swaps in a new ServiceClient. Concurrent
+// callers wait for the refresh already in flight instead of starting their
+// own. Calls holding the previous client finish with it.
+func (p *RackspaceProvider) refreshToken(ctx context.Context) error {
+	_, err := p.authenticate(ctx)
+	return err
+}
+
+// authenticate is refreshToken, also returning the credentials the shared
+// refresh authenticated with.
+func (p *RackspaceProvider) authenticate(ctx context.Context) (credentials, error) {
+	v, err, _ := p.refresh.group.Do("token", func() (any, error) {
+		ctx, cancel := context.WithTimeout(ctx, authTimeout)
+		defer cancel()
+
+		p.mu.RLock()
+		config := *p.config
+		p.mu.RUnlock()
+		used := credentials{username: config.Username, apiKey: config.APIKey}
+
+		client, tokenExpiry, err := authenticateAndCreateClient(ctx, p.authProvider, &config, p.recordReauth)
+
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if err != nil {
+			metrics.TokenRefreshes.WithLabelValues("failure").Inc()
+			p.lastAuthErr = err
+			p.refresh.failures++
+			return used, err
+		}
+		metrics.TokenRefreshes.WithLabelValues("success").Inc()
+		p.lastAuthErr = nil
+		p.refresh.failures = 0
+		p.refresh.last = time.Now()
+		p.serviceClient = p.newServiceClient(client)
+		p.tokenExpiry = tokenExpiry
+		logging.FromContext(ctx).Info("Refreshed Rackspace token", "expiresAt", tokenExpiry)
+		return used, nil
+	})
+	used, _ := v.(credentials)
+	return used, err
+}
+
+// recordReauth takes in a re-authentication the client made on its own
+// after Cloud DNS rejected the token, so readiness and RunTokenRefresher
+// work from the new token rather than the revoked one.
+func (p *RackspaceProvider) recordReauth(tokenExpiry time.Time, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err != nil {
+		p.lastAuthErr = err
+		p.refresh.failures++
+		return
+	}
+	p.tokenExpiry = tokenExpiry
+	p.lastAuthErr = nil
+	p.refresh.failures = 0
+	p.refresh.last = time.Now()
+}
+
+// RunTokenRefresher renews the token an hour before it expires until ctx is
+// done. Failed renewals are retried with jittered exponential backoff while
+// the current token stays in use.
+func (p *RackspaceProvider) RunTokenRefresher(ctx context.Context) {
+	var backoff, minWait time.Duration
+	for {
+		wait := max(time.Until(p.TokenStatus().RefreshAt), minWait)
+		if backoff > 0 {
+			wait = backoff/2 + time.Duration(rand.Int64N(int64(backoff/2)+1))
+		}
+		timer := time.NewTimer(max(wait, 0))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		if err := p.refreshToken(ctx); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			backoff = min(max(2*backoff, tokenRefreshInitialBackoff), tokenRefreshMaxBackoff)
+			logging.FromContext(ctx).Warn("Token refresh failed, retrying", "error", err, "backoff", backoff)
+			continue
+		}
+		backoff = 0
+		// Identity may hand back the current token with its original
+		// expiry, which is already due for renewal. Wait half of its
+		// remaining lifetime rather than authenticating in a loop.
+		minWait = max(time.Until(p.TokenStatus().ExpiresAt)/2, tokenRefreshInitialBackoff)
+	}
+}
+
+// TokenStatus reports when the token expires, when it is due for renewal and
+// how renewals have been going.
+func (p *RackspaceProvider) TokenStatus() TokenStatus {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.tokenStatusLocked()
+}
+
+func (p *RackspaceProvider) tokenStatusLocked() TokenStatus {
+	return TokenStatus{
+		ExpiresAt:           p.tokenExpiry,
+		RefreshAt:           p.tokenExpiry.Add(tokenRefreshBeforeTime),
+		LastRefresh:         p.refresh.last,
+		ConsecutiveFailures: p.refresh.failures,
+	}
+}
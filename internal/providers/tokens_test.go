@@ -0,0 +1,156 @@
+package providers
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gophercloud/gophercloud/v2"
+	"github.com/rackerlabs/goraxauth"
+)
+
+// gatedAuthProvider holds every authentication until release is closed.
+type gatedAuthProvider struct {
+	fakeAuthProvider
+	mu      sync.Mutex
+	release chan struct{}
+}
+
+func (g *gatedAuthProvider) Authenticate(ctx context.Context, opts goraxauth.AuthOptions) (*gophercloud.ProviderClient, error) {
+	<-g.release
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.fakeAuthProvider.Authenticate(ctx, opts)
+}
+
+func newTokenTestProvider(auth AuthProvider, tokenExpiry time.Time) *RackspaceProvider {
+	p := &RackspaceProvider{
+		authProvider: auth,
+		tokenExpiry:  tokenExpiry,
+		config:       &RackspaceConfig{Username: "user", APIKey: "key"},
+	}
+	p.serviceClient = p.newServiceClient(FakeDNSClient("http://localhost/"))
+	return p
+}
+
+func TestGetClient_ValidTokenDoesNotAuthenticate(t *testing.T) {
+	auth := &fakeAuthProvider{endpoint: "http://localhost/"}
+	p := newTokenTestProvider(auth, time.Now().Add(10*time.Minute))
+	original := p.serviceClient
+
+	if got := p.getClient(context.Background()); got != original {
+		t.Error("expected the current client to be returned")
+	}
+	if len(auth.attempts) != 0 {
+		t.Errorf("expected no authentication, got %d", len(auth.attempts))
+	}
+}
+
+func TestGetClient_ExpiredTokenRefreshesOnce(t *testing.T) {
+	auth := &gatedAuthProvider{fakeAuthProvider: fakeAuthProvider{endpoint: "http://localhost/"}, release: make(chan struct{})}
+	p := newTokenTestProvider(auth, time.Now().Add(-time.Minute))
+	original := p.serviceClient
+
+	var wg sync.WaitGroup
+	clients := make([]ServiceClient, 10)
+	for i := range clients {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			clients[i] = p.getClient(context.Background())
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(auth.release)
+	wg.Wait()
+
+	if len(auth.attempts) != 1 {
+		t.Errorf("expected concurrent callers to share one authentication, got %d", len(auth.attempts))
+	}
+	for i, client := range clients {
+		if client == original {
+			t.Errorf("caller %d received the expired client", i)
+		}
+	}
+	if status := p.TokenStatus(); !status.ExpiresAt.After(time.Now()) || status.LastRefresh.IsZero() {
+		t.Errorf("expected a renewed token, got %+v", status)
+	}
+}
+
+func TestRunTokenRefresher(t *testing.T) {
+	auth := &fakeAuthProvider{endpoint: "http://localhost/", reject: map[string]bool{"bad-key": true}}
+	// Due for renewal, but not yet expired.
+	p := newTokenTestProvider(auth, time.Now().Add(30*time.Minute))
+	p.config.APIKey = "bad-key"
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		p.RunTokenRefresher(ctx)
+	}()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for p.TokenStatus().ConsecutiveFailures == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if status := p.TokenStatus(); status.ConsecutiveFailures != 1 {
+		t.Fatalf("expected one failed renewal, got %+v", status)
+	}
+	readiness := p.Readiness()
+	if readiness.Ready || readiness.Token.ConsecutiveFailures != 1 {
+		t.Errorf("expected readiness to report the failed renewal, got %+v", readiness)
+	}
+	if readiness.Checks["token"].OK != true {
+		t.Error("expected the still-valid token to pass the token check")
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("RunTokenRefresher did not stop after cancellation")
+	}
+}
+
+func TestRunTokenRefresher_RenewsAheadOfExpiry(t *testing.T) {
+	auth := &fakeAuthProvider{endpoint: "http://localhost/"}
+	p := newTokenTestProvider(auth, time.Now().Add(30*time.Minute))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go p.RunTokenRefresher(ctx)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for p.TokenStatus().LastRefresh.IsZero() && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	status := p.TokenStatus()
+	if status.LastRefresh.IsZero() || !status.RefreshAt.After(time.Now()) {
+		t.Fatalf("expected the token to be renewed before it expired, got %+v", status)
+	}
+}
+
+func TestRunTokenRefresher_ShortLivedToken(t *testing.T) {
+	// Identity keeps returning a token that is already within the hour
+	// before its expiry.
+	auth := &gatedAuthProvider{fakeAuthProvider: fakeAuthProvider{endpoint: "http://localhost/", expiresIn: 30 * time.Minute}, release: make(chan struct{})}
+	close(auth.release)
+	p := newTokenTestProvider(auth, time.Now().Add(30*time.Minute))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go p.RunTokenRefresher(ctx)
+
+	time.Sleep(200 * time.Millisecond)
+	auth.mu.Lock()
+	attempts := len(auth.attempts)
+	auth.mu.Unlock()
+	if attempts != 1 {
+		t.Errorf("expected a single renewal of the short-lived token, got %d", attempts)
+	}
+	if status := p.TokenStatus(); status.ExpiresAt.After(time.Now().Add(31 * time.Minute)) {
+		t.Errorf("expected the token expiry from Identity, got %+v", status)
+	}
+}
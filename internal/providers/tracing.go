@@ -0,0 +1,105 @@
+package providers
+
+import (
+	"context"
+	"slices"
+
+	"github.com/rackerlabs/goclouddns/domains"
+	"github.com/rackerlabs/goclouddns/records"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/rackerlabs/external-dns-rackspace-webhook/internal/tracing"
+)
+
+// tracingServiceClient opens a client span for every Cloud DNS write. It
+// wraps the retrying client, so a span covers rate limiter waits, retries
+// and the async job poll. Listings are traced by eachPageWithRetry.
+type tracingServiceClient struct {
+	ServiceClient
+}
+
+func newTracingServiceClient(next ServiceClient) ServiceClient {
+	return &tracingServiceClient{ServiceClient: next}
+}
+
+func startClientSpan(ctx context.Context, operation, domainID string) (context.Context, trace.Span) {
+	return tracing.Start(ctx, "cloud_dns."+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(tracing.DomainIDKey.String(domainID)),
+	)
+}
+
+func createTypes(opts []records.CreateOpts) []string {
+	var types []string
+	for _, o := range opts {
+		if !slices.Contains(types, o.Type) {
+			types = append(types, o.Type)
+		}
+	}
+	return types
+}
+
+func (t *tracingServiceClient) CreateRecord(ctx context.Context, domainID string, opts records.CreateOpts) (created *records.RecordList, err error) {
+	ctx, span := startClientSpan(ctx, "create_record", domainID)
+	defer func() { tracing.End(span, err) }()
+	span.SetAttributes(tracing.RecordNameKey.String(opts.Name), tracing.RecordTypeKey.String(opts.Type))
+	return t.ServiceClient.CreateRecord(ctx, domainID, opts)
+}
+
+func (t *tracingServiceClient) CreateRecords(ctx context.Context, domainID string, opts []records.CreateOpts) (created []records.RecordList, err error) {
+	ctx, span := startClientSpan(ctx, "create_records", domainID)
+	defer func() { tracing.End(span, err) }()
+	span.SetAttributes(tracing.RecordCountKey.Int(len(opts)), tracing.RecordTypeKey.StringSlice(createTypes(opts)))
+	return t.ServiceClient.CreateRecords(ctx, domainID, opts)
+}
+
+func (t *tracingServiceClient) CreateDomain(ctx context.Context, opts domains.CreateOpts) (created *domains.DomainList, err error) {
+	ctx, span := startClientSpan(ctx, "create_domain", "")
+	defer func() {
+		if created != nil {
+			span.SetAttributes(tracing.DomainIDKey.String(created.ID))
+		}
+		tracing.End(span, err)
+	}()
+	span.SetAttributes(tracing.DomainNameKey.String(opts.Name))
+	return t.ServiceClient.CreateDomain(ctx, opts)
+}
+
+func (t *tracingServiceClient) ListPTRRecords(ctx context.Context, service, href string) (ptrs []records.RecordList, err error) {
+	ctx, span := startClientSpan(ctx, "list_rdns", "")
+	defer func() { tracing.End(span, err) }()
+	return t.ServiceClient.ListPTRRecords(ctx, service, href)
+}
+
+func (t *tracingServiceClient) AddPTRRecords(ctx context.Context, service, href string, opts []records.CreateOpts) (err error) {
+	ctx, span := startClientSpan(ctx, "create_rdns", "")
+	defer func() { tracing.End(span, err) }()
+	span.SetAttributes(tracing.RecordCountKey.Int(len(opts)))
+	return t.ServiceClient.AddPTRRecords(ctx, service, href, opts)
+}
+
+func (t *tracingServiceClient) DeletePTRRecord(ctx context.Context, service, href, ip string) (err error) {
+	ctx, span := startClientSpan(ctx, "delete_rdns", "")
+	defer func() { tracing.End(span, err) }()
+	return t.ServiceClient.DeletePTRRecord(ctx, service, href, ip)
+}
+
+func (t *tracingServiceClient) UpdateRecord(ctx context.Context, domainID, recordID string, opts records.UpdateOpts) (err error) {
+	ctx, span := startClientSpan(ctx, "update_record", domainID)
+	defer func() { tracing.End(span, err) }()
+	span.SetAttributes(tracing.RecordNameKey.String(opts.Name))
+	return t.ServiceClient.UpdateRecord(ctx, domainID, recordID, opts)
+}
+
+func (t *tracingServiceClient) DeleteRecord(ctx context.Context, domainID, recordID string) (err error) {
+	ctx, span := startClientSpan(ctx, "delete_record", domainID)
+	defer func() { tracing.End(span, err) }()
+	return t.ServiceClient.DeleteRecord(ctx, domainID, recordID)
+}
+
+func (t *tracingServiceClient) DeleteRecords(ctx context.Context, domainID string, recordIDs []string) (err error) {
+	ctx, span := startClientSpan(ctx, "delete_records", domainID)
+	defer func() { tracing.End(span, err) }()
+	span.SetAttributes(tracing.RecordCountKey.Int(len(recordIDs)))
+	return t.ServiceClient.DeleteRecords(ctx, domainID, recordIDs)
+}
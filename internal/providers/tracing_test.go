@@ -0,0 +1,131 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	th "github.com/gophercloud/gophercloud/v2/testhelper"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+
+	"github.com/rackerlabs/external-dns-rackspace-webhook/internal/tracing"
+)
+
+// newTestTracer installs an in-memory span exporter for the duration of the test.
+func newTestTracer(t *testing.T) *tracetest.InMemoryExporter {
+	t.Helper()
+	exporter := tracetest.NewInMemoryExporter()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+	return exporter
+}
+
+func spanAttr(span tracetest.SpanStub, key attribute.Key) (attribute.Value, bool) {
+	for _, kv := range span.Attributes {
+		if kv.Key == key {
+			return kv.Value, true
+		}
+	}
+	return attribute.Value{}, false
+}
+
+func TestApplyChanges_Spans(t *testing.T) {
+	exporter := newTestTracer(t)
+	fakeServer := th.SetupHTTP()
+	defer fakeServer.Teardown()
+
+	fakeServer.Mux.HandleFunc("/domains", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprint(w, `{"domains":[{"id":"111","name":"example.com"}]}`)
+	})
+	fakeServer.Mux.HandleFunc("/domains/111/records", func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, "POST")
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = fmt.Fprint(w, `{"code":400,"message":"Validation error"}`)
+	})
+
+	p := newTestProvider(t, fakeServer.Endpoint())
+	p.serviceClient = newTracingServiceClient(p.serviceClient)
+	changes := &plan.Changes{Create: []*endpoint.Endpoint{
+		{DNSName: "www.example.com", RecordType: "A", Targets: []string{"10.0.0.1"}},
+	}}
+	if err := p.ApplyChanges(context.Background(), changes); err == nil {
+		t.Fatal("expected ApplyChanges() to fail")
+	}
+
+	byName := map[string]tracetest.SpanStub{}
+	for _, span := range exporter.GetSpans() {
+		byName[span.Name] = span
+	}
+	for _, name := range []string{"ApplyChanges", "findDomain", "cloud_dns.list_domains", "cloud_dns.create_records"} {
+		if _, ok := byName[name]; !ok {
+			t.Fatalf("expected a %q span, got %v", name, exporter.GetSpans().Snapshots())
+		}
+	}
+
+	create := byName["cloud_dns.create_records"]
+	if create.Parent.SpanID() != byName["ApplyChanges"].SpanContext.SpanID() {
+		t.Error("expected create_records to be a child of ApplyChanges")
+	}
+	if v, ok := spanAttr(create, tracing.DomainIDKey); !ok || v.AsString() != "111" {
+		t.Errorf("expected dns.domain_id 111, got %v", v)
+	}
+	if v, ok := spanAttr(create, tracing.RecordTypeKey); !ok || len(v.AsStringSlice()) != 1 || v.AsStringSlice()[0] != "A" {
+		t.Errorf("expected dns.record_type [A], got %v", v)
+	}
+	if create.Status.Code != codes.Error || byName["ApplyChanges"].Status.Code != codes.Error {
+		t.Errorf("expected failed spans, got create=%v apply=%v", create.Status, byName["ApplyChanges"].Status)
+	}
+	if v, ok := spanAttr(byName["findDomain"], tracing.DomainIDKey); !ok || v.AsString() != "111" {
+		t.Errorf("expected findDomain to record the matched domain, got %v", v)
+	}
+}
+
+func TestRecords_SpanRecordsPages(t *testing.T) {
+	exporter := newTestTracer(t)
+	fakeServer := th.SetupHTTP()
+	defer fakeServer.Teardown()
+
+	fakeServer.Mux.HandleFunc("/domains", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprint(w, `{"domains":[{"id":"111","name":"example.com"}]}`)
+	})
+	fakeServer.Mux.HandleFunc("/domains/111/records", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprint(w, `{"records":[{"id":"r1","name":"www.example.com","type":"A","data":"10.0.0.1","ttl":300}]}`)
+	})
+
+	p := newTestProvider(t, fakeServer.Endpoint())
+	if _, err := p.Records(context.Background()); err != nil {
+		t.Fatalf("Records() error: %v", err)
+	}
+
+	var found bool
+	for _, span := range exporter.GetSpans() {
+		if span.Name != "cloud_dns.list_records" {
+			continue
+		}
+		found = true
+		if v, _ := spanAttr(span, tracing.DomainIDKey); v.AsString() != "111" {
+			t.Errorf("expected dns.domain_id 111, got %v", v)
+		}
+		if v, _ := spanAttr(span, tracing.RecordCountKey); v.AsInt64() != 1 {
+			t.Errorf("expected dns.record_count 1, got %v", v)
+		}
+		if len(span.Events) != 1 || span.Events[0].Name != "page" {
+			t.Errorf("expected one page event, got %v", span.Events)
+		}
+	}
+	if !found {
+		t.Fatal("expected a cloud_dns.list_records span")
+	}
+}
@@ -0,0 +1,139 @@
+package providers
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+// TTLPolicy bounds the TTLs written to Cloud DNS. Zero fields are unset:
+// an unset Min or Max does not clamp and an unset Default leaves the TTL to
+// Cloud DNS.
+type TTLPolicy struct {
+	Min     int64
+	Max     int64
+	Default int64
+}
+
+// merge returns p with every unset field taken from base.
+func (p TTLPolicy) merge(base TTLPolicy) TTLPolicy {
+	if p.Min == 0 {
+		p.Min = base.Min
+	}
+	if p.Max == 0 {
+		p.Max = base.Max
+	}
+	if p.Default == 0 {
+		p.Default = base.Default
+	}
+	return p
+}
+
+// apply returns the TTL to request for an endpoint that asked for ttl.
+func (p TTLPolicy) apply(ttl endpoint.TTL) endpoint.TTL {
+	if !ttl.IsConfigured() {
+		ttl = endpoint.TTL(p.Default)
+	}
+	if !ttl.IsConfigured() {
+		return ttl
+	}
+	if p.Min > 0 && int64(ttl) < p.Min {
+		ttl = endpoint.TTL(p.Min)
+	}
+	if p.Max > 0 && int64(ttl) > p.Max {
+		ttl = endpoint.TTL(p.Max)
+	}
+	return ttl
+}
+
+// Validate reports negative values and a minimum above the maximum.
+func (p TTLPolicy) Validate() error {
+	if p.Min < 0 || p.Max < 0 || p.Default < 0 {
+		return fmt.Errorf("TTL values must not be negative")
+	}
+	if p.Min > 0 && p.Max > 0 && p.Min > p.Max {
+		return fmt.Errorf("minimum TTL %d is greater than maximum TTL %d", p.Min, p.Max)
+	}
+	return nil
+}
+
+// ParseTTLOverrides parses per-domain TTL policies written as
+// "example.com:min=60,max=3600,default=300;example.org:default=600".
+func ParseTTLOverrides(value string) (map[string]TTLPolicy, error) {
+	overrides := map[string]TTLPolicy{}
+	for _, entry := range strings.Split(value, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		domain, settings, ok := strings.Cut(entry, ":")
+		domain = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(domain)), ".")
+		if !ok || domain == "" {
+			return nil, fmt.Errorf("invalid TTL override %q: expected domain:key=value", entry)
+		}
+		var policy TTLPolicy
+		for _, setting := range strings.Split(settings, ",") {
+			key, raw, ok := strings.Cut(strings.TrimSpace(setting), "=")
+			if !ok {
+				return nil, fmt.Errorf("invalid TTL override %q: expected key=value, got %q", entry, setting)
+			}
+			seconds, err := strconv.ParseInt(strings.TrimSpace(raw), 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid TTL override %q: %s is not a number of seconds", entry, raw)
+			}
+			switch strings.TrimSpace(key) {
+			case "min":
+				policy.Min = seconds
+			case "max":
+				policy.Max = seconds
+			case "default":
+				policy.Default = seconds
+			default:
+				return nil, fmt.Errorf("invalid TTL override %q: unknown key %q", entry, key)
+			}
+		}
+		if err := policy.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid TTL override for %s: %w", domain, err)
+		}
+		overrides[domain] = policy
+	}
+	return overrides, nil
+}
+
+// ValidateTTLOverrides checks each override merged over the global policy,
+// as ttlPolicyFor applies it. An override is valid on its own yet can end
+// up with a minimum above the global maximum, such as min=7200 with
+// TTL_MAX=3600.
+func ValidateTTLOverrides(global TTLPolicy, overrides map[string]TTLPolicy) error {
+	for _, domain := range slices.Sorted(maps.Keys(overrides)) {
+		if err := overrides[domain].merge(global).Validate(); err != nil {
+			return fmt.Errorf("TTL override for %s with the global TTL settings: %w", domain, err)
+		}
+	}
+	return nil
+}
+
+// ttlPolicyFor returns the policy for dnsName: the override of the longest
+// matching domain merged over the global policy.
+func (p *RackspaceProvider) ttlPolicyFor(dnsName string) TTLPolicy {
+	if p.config == nil {
+		return TTLPolicy{}
+	}
+	name := strings.TrimSuffix(strings.ToLower(dnsName), ".")
+	policy, bestLen := p.config.TTL, -1
+	for domain, override := range p.config.TTLOverrides {
+		if (name == domain || strings.HasSuffix(name, "."+domain)) && len(domain) > bestLen {
+			policy, bestLen = override.merge(p.config.TTL), len(domain)
+		}
+	}
+	return policy
+}
+
+// AdjustTTL applies the TTL policy for ep's domain to ep.RecordTTL.
+func (p *RackspaceProvider) AdjustTTL(ep *endpoint.Endpoint) {
+	ep.RecordTTL = p.ttlPolicyFor(ep.DNSName).apply(ep.RecordTTL)
+}
@@ -0,0 +1,163 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	th "github.com/gophercloud/gophercloud/v2/testhelper"
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+func TestAdjustTTL(t *testing.T) {
+	p := &RackspaceProvider{config: &RackspaceConfig{
+		TTL: TTLPolicy{Min: 300, Max: 86400, Default: 3600},
+		TTLOverrides: map[string]TTLPolicy{
+			"example.com":         {Default: 600},
+			"staging.example.com": {Min: 60},
+		},
+	}}
+
+	tests := []struct {
+		name    string
+		dnsName string
+		ttl     endpoint.TTL
+		want    endpoint.TTL
+	}{
+		{name: "unset uses global default", dnsName: "www.example.org", ttl: 0, want: 3600},
+		{name: "below minimum is raised", dnsName: "www.example.org", ttl: 60, want: 300},
+		{name: "above maximum is lowered", dnsName: "www.example.org", ttl: 172800, want: 86400},
+		{name: "within range is kept", dnsName: "www.example.org", ttl: 900, want: 900},
+		{name: "domain override default", dnsName: "www.example.com.", ttl: 0, want: 600},
+		{name: "override keeps global minimum", dnsName: "www.example.com", ttl: 60, want: 300},
+		{name: "longest override wins", dnsName: "app.staging.example.com", ttl: 60, want: 60},
+		{name: "longest override inherits global default", dnsName: "app.staging.example.com", ttl: 0, want: 3600},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ep := &endpoint.Endpoint{DNSName: tt.dnsName, RecordType: "A", RecordTTL: tt.ttl}
+			p.AdjustTTL(ep)
+			if ep.RecordTTL != tt.want {
+				t.Errorf("AdjustTTL() = %d, want %d", ep.RecordTTL, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTTLOverrides(t *testing.T) {
+	got, err := ParseTTLOverrides("Example.com.:min=60,default=300; example.org:max=3600")
+	if err != nil {
+		t.Fatalf("ParseTTLOverrides() error = %v", err)
+	}
+	want := map[string]TTLPolicy{
+		"example.com": {Min: 60, Default: 300},
+		"example.org": {Max: 3600},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("ParseTTLOverrides() = %+v, want %+v", got, want)
+	}
+	for domain, policy := range want {
+		if got[domain] != policy {
+			t.Errorf("override for %s = %+v, want %+v", domain, got[domain], policy)
+		}
+	}
+
+	for _, invalid := range []string{"example.com", "example.com:min", "example.com:min=abc", "example.com:ttl=60", "example.com:min=600,max=60"} {
+		if _, err := ParseTTLOverrides(invalid); err == nil {
+			t.Errorf("ParseTTLOverrides(%q) expected an error", invalid)
+		}
+	}
+}
+
+func TestValidateTTLOverrides(t *testing.T) {
+	global := TTLPolicy{Min: 300, Max: 3600, Default: 600}
+	valid := map[string]TTLPolicy{"example.com": {Min: 60}, "example.org": {Max: 7200, Default: 3600}}
+	if err := ValidateTTLOverrides(global, valid); err != nil {
+		t.Errorf("ValidateTTLOverrides() error = %v", err)
+	}
+
+	invalid := map[string]TTLPolicy{"example.com": {Min: 60}, "slow.example.com": {Min: 7200}}
+	err := ValidateTTLOverrides(global, invalid)
+	if err == nil || !strings.Contains(err.Error(), "slow.example.com") || !strings.Contains(err.Error(), "minimum TTL 7200 is greater than maximum TTL 3600") {
+		t.Errorf("expected the merged override for slow.example.com to be rejected, got %v", err)
+	}
+}
+
+func TestCreateRecord_PassesTTL(t *testing.T) {
+	fakeServer := th.SetupHTTP()
+	defer fakeServer.Teardown()
+
+	fakeServer.Mux.HandleFunc("/domains", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprint(w, `{"domains":[{"id":"111","name":"example.com"}]}`)
+	})
+	var gotTTL float64
+	fakeServer.Mux.HandleFunc("/domains/111/records", func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, "POST")
+		var payload struct {
+			Records []struct {
+				TTL float64 `json:"ttl"`
+			} `json:"records"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Fatalf("failed to parse request body: %v", err)
+		}
+		if len(payload.Records) > 0 {
+			gotTTL = payload.Records[0].TTL
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		_, _ = fmt.Fprint(w, `{"status":"COMPLETED","response":{"records":[{"id":"r1"}]}}`)
+	})
+
+	p := newTestProvider(t, fakeServer.Endpoint())
+	ep := endpoint.NewEndpointWithTTL("www.example.com", "A", 900, "10.0.0.1")
+	if err := p.createRecord(context.Background(), ep); err != nil {
+		t.Fatalf("createRecord() error = %v", err)
+	}
+	if gotTTL != 900 {
+		t.Errorf("expected ttl 900 in create request, got %v", gotTTL)
+	}
+}
+
+func TestUpdateRecord_RefreshesTTL(t *testing.T) {
+	fakeServer := th.SetupHTTP()
+	defer fakeServer.Teardown()
+
+	fakeServer.Mux.HandleFunc("/domains", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprint(w, `{"domains":[{"id":"111","name":"example.com"}]}`)
+	})
+	fakeServer.Mux.HandleFunc("/domains/111/records", func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, "GET")
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprint(w, `{"records":[{"id":"r1","name":"www.example.com","type":"A","data":"10.0.0.1","ttl":3600}]}`)
+	})
+	var gotTTL float64
+	fakeServer.Mux.HandleFunc("/domains/111/records/r1", func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, "PUT")
+		var payload struct {
+			TTL float64 `json:"ttl"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Fatalf("failed to parse request body: %v", err)
+		}
+		gotTTL = payload.TTL
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		_, _ = fmt.Fprint(w, `{"status":"COMPLETED"}`)
+	})
+
+	p := newTestProvider(t, fakeServer.Endpoint())
+	ep := endpoint.NewEndpointWithTTL("www.example.com", "A", 300, "10.0.0.1")
+	if err := p.updateRecord(context.Background(), nil, ep); err != nil {
+		t.Fatalf("updateRecord() error = %v", err)
+	}
+	if gotTTL != 300 {
+		t.Errorf("expected ttl 300 in update request, got %v", gotTTL)
+	}
+}
@@ -0,0 +1,142 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/rackerlabs/goclouddns/domains"
+
+	"github.com/rackerlabs/external-dns-rackspace-webhook/internal/logging"
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+// zoneComment marks domains created by the webhook in the Cloud DNS console.
+const zoneComment = "Created by external-dns-rackspace-webhook"
+
+// errNoMatchingDomain is returned by findDomain when no managed domain
+// contains a name.
+var errNoMatchingDomain = errors.New("no matching domain found")
+
+// ZoneCreation configures automatic creation of missing Cloud DNS domains.
+type ZoneCreation struct {
+	Enabled bool
+	// Email is the contact address Cloud DNS requires for every domain.
+	Email string
+	// TTL is the default TTL of created domains, in seconds.
+	TTL uint
+	// Parents are the suffixes under which domains may be created. The
+	// created domain is the label directly below the longest matching
+	// parent, so app.pr-42.preview.example.com under preview.example.com
+	// creates pr-42.preview.example.com.
+	Parents []string
+}
+
+// zoneNameFor returns the domain to create for dnsName, or false when
+// dnsName is not below an allowed parent.
+func (z ZoneCreation) zoneNameFor(dnsName string) (string, bool) {
+	name := normalizeDomain(dnsName)
+	best := ""
+	for _, parent := range z.Parents {
+		parent = normalizeDomain(parent)
+		if parent != "" && strings.HasSuffix(name, "."+parent) && len(parent) > len(best) {
+			best = parent
+		}
+	}
+	if best == "" {
+		return "", false
+	}
+	labels := strings.Split(strings.TrimSuffix(name, "."+best), ".")
+	return labels[len(labels)-1] + "." + best, true
+}
+
+// zoneCreationEnabled reports whether missing domains may be created.
+func (p *RackspaceProvider) zoneCreationEnabled() bool {
+	return p.config != nil && p.config.ZoneCreation.Enabled
+}
+
+// createZone creates the domain that should hold dnsName. The domain list
+// cache is dropped so the following lookups find the new domain.
+func (p *RackspaceProvider) createZone(ctx context.Context, dnsName string) (*domains.DomainList, error) {
+	zoneCreation := p.config.ZoneCreation
+	zoneName, ok := zoneCreation.zoneNameFor(dnsName)
+	if !ok {
+		return nil, fmt.Errorf("%w for %s, and it is not below a parent allowed for zone creation", errNoMatchingDomain, dnsName)
+	}
+
+	domain, err := p.getClient(ctx).CreateDomain(ctx, domains.CreateOpts{
+		Name:    zoneName,
+		Email:   zoneCreation.Email,
+		TTL:     zoneCreation.TTL,
+		Comment: zoneComment,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create domain %s: %w", zoneName, err)
+	}
+	p.cache.invalidateDomains()
+
+	// The domain filter may only cover the names requested so far; add the
+	// domain itself so its records are listed and it is negotiated with
+	// external-dns.
+	p.rememberCreatedZones([]string{domain.Name})
+	logging.FromContext(ctx).Info("Created domain", "domain", domain.Name, "id", domain.ID, "for", dnsName)
+	return domain, nil
+}
+
+// rememberCreatedZones adds domains created by the webhook to the managed
+// zones. fetchDomains passes every domain carrying zoneComment, so created
+// domains stay managed across restarts. Domains the filter already covers,
+// or that are not below an allowed parent, are left out.
+func (p *RackspaceProvider) rememberCreatedZones(names []string) {
+	if !p.zoneCreationEnabled() {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, name := range names {
+		name = normalizeDomain(name)
+		if p.DomainFilter.Match(name) || slices.Contains(p.createdZones, name) {
+			continue
+		}
+		if zoneName, ok := p.config.ZoneCreation.zoneNameFor(name); !ok || zoneName != name {
+			continue
+		}
+		p.createdZones = append(p.createdZones, name)
+	}
+}
+
+// matchZone reports whether a Cloud DNS domain is managed: it matches the
+// domain filter or was created by the webhook.
+func (p *RackspaceProvider) matchZone(name string) bool {
+	if p.DomainFilter.Match(name) {
+		return true
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return slices.Contains(p.createdZones, normalizeDomain(name))
+}
+
+// createdZoneNames returns the domains created by the webhook.
+func (p *RackspaceProvider) createdZoneNames() []string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return slices.Clone(p.createdZones)
+}
+
+// negotiatedDomainFilter returns the domain filter extended with the
+// domains created by the webhook. Names are matched against it when
+// records are listed and written, so every name inside a created domain is
+// managed, not only the ones DOMAIN_FILTER lists.
+func (p *RackspaceProvider) negotiatedDomainFilter() *endpoint.DomainFilter {
+	created := p.createdZoneNames()
+	if len(created) == 0 {
+		return p.DomainFilter
+	}
+	p.mu.RLock()
+	config := *p.config
+	p.mu.RUnlock()
+	config.DomainFilter = append(slices.Clone(config.DomainFilter), created...)
+	return newDomainFilter(&config)
+}
@@ -0,0 +1,172 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	th "github.com/gophercloud/gophercloud/v2/testhelper"
+	"github.com/rackerlabs/goclouddns/domains"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+func TestZoneCreation_ZoneNameFor(t *testing.T) {
+	z := ZoneCreation{Parents: []string{"preview.example.com", "eu.preview.example.com."}}
+	tests := []struct {
+		dnsName string
+		want    string
+		wantOK  bool
+	}{
+		{dnsName: "app.pr-42.preview.example.com", want: "pr-42.preview.example.com", wantOK: true},
+		{dnsName: "pr-42.preview.example.com.", want: "pr-42.preview.example.com", wantOK: true},
+		{dnsName: "a.b.pr-42.eu.preview.example.com", want: "pr-42.eu.preview.example.com", wantOK: true},
+		{dnsName: "preview.example.com"},
+		{dnsName: "www.example.com"},
+		{dnsName: "app.notpreview.example.com"},
+	}
+	for _, tt := range tests {
+		got, ok := z.zoneNameFor(tt.dnsName)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("zoneNameFor(%q) = %q, %v; want %q, %v", tt.dnsName, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestApplyChanges_CreatesMissingZone(t *testing.T) {
+	fakeServer := th.SetupHTTP()
+	defer fakeServer.Teardown()
+
+	var mu sync.Mutex
+	zones := []string{`{"id":"111","name":"example.com"}`}
+	var createdDomains []domains.CreateOpts
+	var createdRecords int
+	fakeServer.Mux.HandleFunc("/domains", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == http.MethodPost {
+			var payload struct {
+				Domains []domains.CreateOpts `json:"domains"`
+			}
+			_ = json.NewDecoder(r.Body).Decode(&payload)
+			createdDomains = append(createdDomains, payload.Domains...)
+			zone := fmt.Sprintf(`{"id":"333","name":%q}`, payload.Domains[0].Name)
+			zones = append(zones, zone)
+			w.WriteHeader(http.StatusAccepted)
+			_, _ = fmt.Fprintf(w, `{"status":"COMPLETED","response":{"domains":[%s]}}`, zone)
+			return
+		}
+		_, _ = fmt.Fprintf(w, `{"domains":[%s]}`, strings.Join(zones, ","))
+	})
+	fakeServer.Mux.HandleFunc("/domains/333/records", func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, "POST")
+		mu.Lock()
+		createdRecords++
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		_, _ = fmt.Fprint(w, `{"status":"COMPLETED","response":{"records":[{"id":"r1"}]}}`)
+	})
+	fakeServer.Mux.HandleFunc("/domains/333", func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+	})
+
+	p := newTestProvider(t, fakeServer.Endpoint())
+	p.config.DomainFilter = []string{"app.pr-7.preview.example.com", "www.other.org"}
+	p.config.ZoneCreation = ZoneCreation{Enabled: true, Email: "dns@example.com", TTL: 600, Parents: []string{"preview.example.com"}}
+	p.DomainFilter = newDomainFilter(p.config)
+
+	changes := &plan.Changes{Create: []*endpoint.Endpoint{
+		{DNSName: "app.pr-7.preview.example.com", RecordType: "A", Targets: []string{"10.0.0.1"}},
+		{DNSName: "app.pr-7.preview.example.com", RecordType: "TXT", Targets: []string{"heritage=external-dns"}},
+		{DNSName: "www.other.org", RecordType: "A", Targets: []string{"10.0.0.2"}},
+	}}
+	err := p.ApplyChanges(context.Background(), changes)
+	if err == nil || !strings.Contains(err.Error(), "www.other.org, and it is not below a parent allowed for zone creation") {
+		t.Errorf("expected www.other.org to be refused, got %v", err)
+	}
+
+	if len(createdDomains) != 1 {
+		t.Fatalf("expected one domain to be created, got %+v", createdDomains)
+	}
+	if got := createdDomains[0]; got.Name != "pr-7.preview.example.com" || got.Email != "dns@example.com" || got.TTL != 600 || got.Comment != zoneComment {
+		t.Errorf("unexpected domain create request: %+v", got)
+	}
+	if createdRecords != 1 {
+		t.Errorf("expected both records in one create request to domain 333, got %d requests", createdRecords)
+	}
+
+	filter := p.GetDomainFilter()
+	if !filter.Match("pr-7.preview.example.com") {
+		t.Error("expected the created domain to be added to the negotiated domain filter")
+	}
+	if filter.Match("pr-8.preview.example.com") {
+		t.Error("expected other domains to stay outside the negotiated domain filter")
+	}
+
+	// DOMAIN_FILTER lists only app.pr-7, but the whole created domain is
+	// now managed.
+	more := &plan.Changes{Create: []*endpoint.Endpoint{
+		{DNSName: "www.pr-7.preview.example.com", RecordType: "A", Targets: []string{"10.0.0.3"}},
+	}}
+	if err := p.ApplyChanges(context.Background(), more); err != nil {
+		t.Fatalf("ApplyChanges() error for a second name in the created domain: %v", err)
+	}
+	if len(createdDomains) != 1 || createdRecords != 2 {
+		t.Errorf("expected www.pr-7.preview.example.com to be written to the created domain, got %d domains and %d record requests", len(createdDomains), createdRecords)
+	}
+}
+
+func TestRecords_RediscoversCreatedZones(t *testing.T) {
+	fakeServer := th.SetupHTTP()
+	defer fakeServer.Teardown()
+
+	fakeServer.Mux.HandleFunc("/domains", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprint(w, `{"domains":[
+			{"id":"111","name":"example.com"},
+			{"id":"333","name":"pr-7.preview.example.com","comment":"`+zoneComment+`"},
+			{"id":"444","name":"pr-8.preview.example.com"},
+			{"id":"555","name":"other.org","comment":"`+zoneComment+`"}
+		]}`)
+	})
+	fakeServer.Mux.HandleFunc("/domains/333/records", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprint(w, `{"records":[
+			{"id":"r1","name":"app.pr-7.preview.example.com","type":"A","data":"10.0.0.1","ttl":300},
+			{"id":"r2","name":"www.pr-7.preview.example.com","type":"A","data":"10.0.0.3","ttl":300}
+		]}`)
+	})
+	for _, path := range []string{"/domains/111/records", "/domains/444/records", "/domains/555/records"} {
+		fakeServer.Mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		})
+	}
+
+	// A fresh provider, as after a restart, knows nothing of the domains
+	// an earlier instance created.
+	p := newTestProvider(t, fakeServer.Endpoint())
+	p.config.DomainFilter = []string{"app.pr-7.preview.example.com"}
+	p.config.ZoneCreation = ZoneCreation{Enabled: true, Email: "dns@example.com", Parents: []string{"preview.example.com"}}
+	p.DomainFilter = newDomainFilter(p.config)
+
+	endpoints, err := p.Records(context.Background())
+	if err != nil {
+		t.Fatalf("Records() error: %v", err)
+	}
+	if len(endpoints) != 2 {
+		t.Errorf("expected every record of the created domain to be listed, got %v", endpoints)
+	}
+	filter := p.GetDomainFilter()
+	if !filter.Match("pr-7.preview.example.com") {
+		t.Error("expected the created domain to be negotiated with external-dns")
+	}
+	if filter.Match("pr-8.preview.example.com") || filter.Match("other.org") {
+		t.Error("expected domains without the comment, or outside the allowed parents, to stay unmanaged")
+	}
+}
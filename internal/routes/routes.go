@@ -4,6 +4,7 @@ import (
 	"github.com/labstack/echo/v4"
 	echoMiddleware "github.com/labstack/echo/v4/middleware"
 	"github.com/rackerlabs/external-dns-rackspace-webhook/internal/handlers"
+	"github.com/rackerlabs/external-dns-rackspace-webhook/internal/metrics"
 	"github.com/rackerlabs/external-dns-rackspace-webhook/internal/middleware"
 )
 
@@ -11,6 +12,8 @@ import (
 func ConfigureWebhookRoutes(e *echo.Echo, h *handlers.Handler) {
 	e.Use(echoMiddleware.Recover())
 	e.Pre(echoMiddleware.RemoveTrailingSlash())
+	e.Use(middleware.RequestIDMiddleware())
+	e.Use(middleware.TracingMiddleware)
 	e.Use(middleware.ExternalDNSContentTypeMiddleware)
 
 	// Domain filter negotiation endpoint
@@ -27,4 +30,6 @@ func ConfigureWebhookRoutes(e *echo.Echo, h *handlers.Handler) {
 func ConfigureOpsRoutes(e *echo.Echo, h *handlers.Handler) {
 	e.Use(echoMiddleware.Recover())
 	e.GET("/healthz", h.HealthHandler)
+	e.GET("/readyz", h.ReadyHandler)
+	e.GET("/metrics", echo.WrapHandler(metrics.Handler()))
 }
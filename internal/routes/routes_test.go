@@ -0,0 +1,36 @@
+package routes
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/rackerlabs/external-dns-rackspace-webhook/internal/handlers"
+	"github.com/rackerlabs/external-dns-rackspace-webhook/internal/metrics"
+)
+
+func TestConfigureOpsRoutes_ServesMetrics(t *testing.T) {
+	e := echo.New()
+	ConfigureOpsRoutes(e, handlers.NewHandler(nil))
+	metrics.APIRequests.WithLabelValues("list_domains", "200").Inc()
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /metrics returned %d", rec.Code)
+	}
+	body := rec.Body.String()
+	for _, want := range []string{
+		`rackspace_webhook_api_requests_total{code="200",operation="list_domains"}`,
+		"go_goroutines",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected /metrics to contain %s", want)
+		}
+	}
+}
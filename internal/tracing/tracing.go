@@ -0,0 +1,88 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.40.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/rackerlabs/external-dns-rackspace-webhook/internal/logging"
+)
+
+const (
+	instrumentationName = "github.com/rackerlabs/external-dns-rackspace-webhook"
+	serviceName         = "external-dns-rackspace-webhook"
+)
+
+// Setup installs the W3C trace context propagator and, when enabled, a
+// tracer provider exporting spans over OTLP/HTTP. The exporter reads the
+// standard OTEL_EXPORTER_OTLP_* variables for its endpoint and headers.
+// When tracing is disabled spans are still created against the global no-op
+// provider, so instrumented code never checks whether tracing is on. The
+// returned function flushes and stops the exporter.
+func Setup(ctx context.Context, enabled bool) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	if !enabled {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP trace exporter: %w", err)
+	}
+	res, err := resource.New(ctx,
+		resource.WithAttributes(semconv.ServiceName(serviceName)),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build trace resource: %w", err)
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// Tracer returns the tracer used for every span the webhook creates.
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// Start opens a span named name as a child of any span in ctx.
+func Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return Tracer().Start(ctx, name, opts...)
+}
+
+// End records err on span, marks the span's status and ends it. Error text
+// is redacted the same way as log output before it leaves the process.
+func End(span trace.Span, err error) {
+	if err != nil {
+		message := logging.Redact(err.Error())
+		span.RecordError(errors.New(message))
+		span.SetStatus(codes.Error, message)
+	} else {
+		span.SetStatus(codes.Ok, "")
+	}
+	span.End()
+}
+
+// Attribute keys shared by provider and ServiceClient spans.
+const (
+	DomainIDKey    = attribute.Key("dns.domain_id")
+	DomainNameKey  = attribute.Key("dns.domain_name")
+	RecordNameKey  = attribute.Key("dns.record_name")
+	RecordTypeKey  = attribute.Key("dns.record_type")
+	RecordCountKey = attribute.Key("dns.record_count")
+)